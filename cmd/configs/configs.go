@@ -1,33 +1,87 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/ivanmashin/vanya/internal/configs"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func main() {
-	var (
-		rootDir string
-		err     error
-	)
-
-	args := flag.Args()
-	switch len(args) {
-	case 0:
-		rootDir, err = os.Getwd()
-		if err != nil {
-			log.Fatalln(err)
-		}
-	case 1:
-		rootDir = os.Args[1]
-	default:
-		log.Fatalln("invalid number of arguments (exactly one positional argument is required: package path containing config.go source file)")
+	check := flag.Bool("check", false, "do not write config_gen.go, print diff and exit with non-zero code if it is out of date")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [packages]\n\n", os.Args[0])
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Generates config_gen.go for every package matched containing config.go with vanya build tag.")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Packages are go package patterns or directories, e.g. ./... (defaults to the current directory).")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	err = configs.Generate(rootDir)
+	rootDir, err := os.Getwd()
 	if err != nil {
 		log.Fatalln(err)
 	}
+
+	opts := make([]configs.Option, 0)
+
+	if flag.NArg() > 0 {
+		patterns := make([]string, flag.NArg())
+		for i, arg := range flag.Args() {
+			patterns[i] = toPattern(arg)
+		}
+
+		opts = append(opts, configs.WithPatterns(patterns...))
+	}
+
+	if *check {
+		opts = append(opts, configs.WithCheck(os.Stdout))
+	}
+
+	err = configs.Generate(rootDir, opts...)
+	if err != nil {
+		printErrors(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// printErrors prints diagnostics in file:line:col: message format, so editors can jump to them. Other errors are
+// printed as is.
+func printErrors(w io.Writer, err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			printErrors(w, e)
+		}
+
+		return
+	}
+
+	var diagnostics configs.Diagnostics
+	if errors.As(err, &diagnostics) {
+		for _, d := range diagnostics {
+			_, _ = fmt.Fprintln(w, d)
+		}
+
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, err)
+}
+
+// toPattern turns relative directory path into package pattern, so it is not treated as an import path.
+func toPattern(arg string) string {
+	if filepath.IsAbs(arg) || strings.HasPrefix(arg, ".") {
+		return arg
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil || !info.IsDir() {
+		return arg
+	}
+
+	return "./" + filepath.ToSlash(arg)
 }
@@ -0,0 +1,64 @@
+package configs
+
+import (
+	"go/token"
+	"golang.org/x/tools/go/packages"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a problem found in the config source, reported at its position.
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+// String formats diagnostic as compilers do: file:line:col: message.
+func (d Diagnostic) String() string {
+	if !d.Pos.IsValid() {
+		return d.Message
+	}
+
+	return d.Pos.String() + ": " + d.Message
+}
+
+// Diagnostics is returned when config source could not be processed. Each of them is printed on a separate line.
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i := range d {
+		lines[i] = d[i].String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func fromPackageError(pkgErr packages.Error) Diagnostic {
+	return Diagnostic{
+		Pos:     parsePosition(pkgErr.Pos),
+		Message: pkgErr.Msg,
+	}
+}
+
+// parsePosition parses position in file:line:col or file:line format used by packages.Error.
+func parsePosition(pos string) token.Position {
+	position := token.Position{}
+
+	parts := strings.Split(pos, ":")
+	for i := len(parts) - 1; i > 0 && i >= len(parts)-2; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			break
+		}
+
+		position.Column, position.Line = position.Line, n
+		parts = parts[:i]
+	}
+
+	if position.Line > 0 {
+		position.Filename = strings.Join(parts, ":")
+	}
+
+	return position
+}
@@ -5,16 +5,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
 	"go/ast"
+	"go/build/constraint"
+	"go/constant"
 	"go/format"
+	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
 	"io"
-	"log"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -24,293 +36,1107 @@ const (
 	ConfigDstFileName = "config_gen.go"
 )
 
-func Generate(rootDir string) error {
-	pkg, err := findPackage(rootDir)
+// ErrOutdated is returned in check mode when config_gen.go differs from the generated one.
+var ErrOutdated = errors.New("generated file is out of date")
+
+type options struct {
+	check      bool
+	diffOutput io.Writer
+	patterns   []string
+}
+
+type Option func(*options)
+
+// WithCheck enables check mode: config_gen.go is generated in memory and compared with the file on disk instead of
+// being written. Unified diff is printed to w, and ErrOutdated is returned if the files differ.
+func WithCheck(w io.Writer) Option {
+	return func(o *options) {
+		o.check = true
+		o.diffOutput = w
+	}
+}
+
+// WithPatterns sets go package patterns, e.g. ./..., resolved relative to the root directory. Configs are generated
+// for every matched package containing config.go with vanya build tag. By default, only the package in the root
+// directory is generated.
+func WithPatterns(patterns ...string) Option {
+	return func(o *options) {
+		o.patterns = patterns
+	}
+}
+
+// PackageError describes failure to generate config_gen.go for a single package.
+type PackageError struct {
+	PkgPath string
+	Err     error
+}
+
+func (e *PackageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.PkgPath, e.Err)
+}
+
+func (e *PackageError) Unwrap() error {
+	return e.Err
+}
+
+// Generate generates config_gen.go for the packages matched. Failures are reported per package as PackageError
+// joined into a single error.
+func Generate(rootDir string, opts ...Option) error {
+	o := &options{
+		patterns: []string{"."},
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	pkgs, err := loadPackages(rootDir, o.patterns)
 	if err != nil {
 		return err
 	}
 
-	err = joinPackageErrors(pkg)
+	found := false
+	errs := make([]error, 0)
+
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) == 0 && len(pkg.IgnoredFiles) == 0 && len(pkg.Errors) > 0 {
+			// package could not be loaded at all, e.g. pattern refers to missing directory
+			errs = append(errs, &PackageError{PkgPath: pkg.PkgPath, Err: joinPackageErrors(pkg, "")})
+			continue
+		}
+
+		srcFile, ok := findSrcFile(pkg)
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		err = generatePackage(pkg, srcFile, o)
+		if err != nil {
+			errs = append(errs, &PackageError{PkgPath: pkg.PkgPath, Err: err})
+		}
+	}
+
+	if !found && len(errs) == 0 {
+		return fmt.Errorf("no packages with %s having vanya build tag found", ConfigSrcFileName)
+	}
+
+	return errors.Join(errs...)
+}
+
+func generatePackage(pkg *packages.Package, srcFile *ast.File, o *options) error {
+	srcPath := pkg.Fset.File(srcFile.Pos()).Name()
+
+	err := joinPackageErrors(pkg, srcPath)
 	if err != nil {
 		return err
 	}
 
-	srcFile, err := getSrcFile(pkg)
+	gen := newFileGen(pkg, srcFile)
+
+	inspectSrc(gen)
+
+	err = gen.updateDeclarations()
+	if err != nil {
+		return err
+	}
+
+	if len(gen.diagnostics) > 0 {
+		return gen.diagnostics
+	}
+
+	err = gen.generateFile()
 	if err != nil {
 		return err
 	}
 
-	gen := newFileGen(pkg, srcFile)
+	src, err := format.Source(gen.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	dstPath := filepath.Join(filepath.Dir(srcPath), ConfigDstFileName)
+
+	if o.check {
+		return checkFile(dstPath, src, o.diffOutput)
+	}
+
+	err = writeFile(dstPath, src)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// joinPackageErrors returns errors preventing config generation as Diagnostics. Other files of the package are type
+// checked without config_gen.go, so errors outside config.go, e.g. undefined Config, are ignored.
+func joinPackageErrors(pkg *packages.Package, srcPath string) error {
+	diagnostics := make(Diagnostics, 0)
+
+	for _, pkgErr := range pkg.Errors {
+		if pkgErr.Kind == packages.ListError || strings.HasPrefix(pkgErr.Pos, srcPath+":") {
+			diagnostics = append(diagnostics, fromPackageError(pkgErr))
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+
+	return nil
+}
+
+// findSrcFile returns config.go of the package if it is compiled only with vanya build tag.
+func findSrcFile(pkg *packages.Package) (*ast.File, bool) {
+	for _, file := range pkg.Syntax {
+		if filepath.Base(pkg.Fset.File(file.Pos()).Name()) != ConfigSrcFileName {
+			continue
+		}
+
+		if hasVanyaTag(file) {
+			return file, true
+		}
+	}
+
+	return nil, false
+}
+
+func hasVanyaTag(file *ast.File) bool {
+	for _, commentGroup := range file.Comments {
+		if commentGroup.Pos() > file.Package {
+			break
+		}
+
+		for _, comment := range commentGroup.List {
+			if !constraint.IsGoBuild(comment.Text) && !constraint.IsPlusBuild(comment.Text) {
+				continue
+			}
+
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				continue
+			}
+
+			withVanya := expr.Eval(func(tag string) bool { return tag == "vanya" })
+			withoutVanya := expr.Eval(func(tag string) bool { return false })
+
+			return withVanya && !withoutVanya
+		}
+	}
+
+	return false
+}
+
+func loadPackages(rootDir string, patterns []string) ([]*packages.Package, error) {
+	fileset := token.NewFileSet()
+
+	parsedPackages, err := packages.Load(
+		&packages.Config{
+			Mode:       packages.NeedName | packages.NeedImports | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedCompiledGoFiles | packages.NeedDeps | packages.NeedModule,
+			Context:    context.TODO(),
+			Dir:        rootDir,
+			BuildFlags: []string{"-tags=vanya"},
+			Fset:       fileset,
+		}, patterns...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsedPackages) == 0 {
+		return nil, errors.New("unable to find package")
+	}
+
+	return parsedPackages, nil
+}
+
+func inspectSrc(gen *fileGen) {
+	ast.Inspect(
+		gen.srcFile, func(node ast.Node) bool {
+			callExpr, ok := node.(*ast.CallExpr)
+			if !ok || !isBuildConfigsCall(gen.pkg.TypesInfo, callExpr) {
+				return true
+			}
+
+			gen.buildArgs = append(gen.buildArgs, callExpr.Args...)
+
+			return false
+		},
+	)
+
+	if len(gen.buildArgs) == 0 {
+		gen.report(gen.srcFile.Name, "%s.%s call not found", vanyaPkgPath, buildConfigsFuncName)
+		return
+	}
+
+	for _, arg := range gen.buildArgs {
+		inspectTypes(gen, arg)
+	}
+}
+
+const (
+	vanyaPkgPath         = "github.com/ivanmashin/vanya"
+	buildConfigsFuncName = "BuildConfigs"
+)
+
+// isBuildConfigsCall reports whether the call refers to BuildConfigs regardless of the way vanya is imported.
+func isBuildConfigsCall(info *types.Info, callExpr *ast.CallExpr) bool {
+	fn, ok := typeutil.Callee(info, callExpr).(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return false
+	}
+
+	return fn.Pkg().Path() == vanyaPkgPath && fn.Name() == buildConfigsFuncName
+}
+
+func inspectTypes(gen *fileGen, arg ast.Expr) {
+	value, valuePkg, ok := findValue(gen.pkg, arg)
+	if !ok {
+		gen.report(arg, "only composite literals or variables initialized with them are expected as argument in BuildConfigs, got %s", types.ExprString(arg))
+		return
+	}
+
+	named, ok := namedType(valuePkg.TypesInfo.TypeOf(value))
+	if !ok {
+		gen.report(value, "could not resolve named type of %s", types.ExprString(value))
+		return
+	}
+
+	typeName := named.Obj()
+
+	declPkg, ok := findImportedPackage(gen.pkg, typeName.Pkg().Path())
+	if !ok {
+		gen.report(value, "could not find package providing %s", typeName.Name())
+		return
+	}
+
+	spec, ok := findDeclaration(declPkg, typeName.Name())
+	if !ok {
+		gen.report(value, "could not find declaration for %s", types.TypeString(named, nil))
+		return
+	}
+
+	for _, obj := range gen.objects {
+		if obj.name() == typeName.Name() {
+			gen.report(arg, "duplicate config section %s", typeName.Name())
+			return
+		}
+	}
+
+	gen.objects = append(
+		gen.objects, &object{
+			named:    named,
+			spec:     spec,
+			value:    value,
+			valuePkg: valuePkg,
+			local:    gen.isLocal(typeName),
+		},
+	)
+}
+
+// findValue returns composite literal providing default values for BuildConfigs argument together with the package
+// it is declared in. Variables are followed to the expression they are initialized with.
+func findValue(pkg *packages.Package, expr ast.Expr) (*ast.CompositeLit, *packages.Package, bool) {
+	switch expr.(type) {
+	case *ast.ParenExpr:
+		return findValue(pkg, expr.(*ast.ParenExpr).X)
+	case *ast.UnaryExpr:
+		unaryExpr := expr.(*ast.UnaryExpr)
+		if unaryExpr.Op != token.AND {
+			return nil, nil, false
+		}
+
+		return findValue(pkg, unaryExpr.X)
+	case *ast.CompositeLit:
+		return expr.(*ast.CompositeLit), pkg, true
+	case *ast.Ident:
+		return findVarValue(pkg, pkg.TypesInfo.Uses[expr.(*ast.Ident)])
+	case *ast.SelectorExpr:
+		return findVarValue(pkg, pkg.TypesInfo.Uses[expr.(*ast.SelectorExpr).Sel])
+	}
+
+	return nil, nil, false
+}
+
+func findVarValue(pkg *packages.Package, obj types.Object) (*ast.CompositeLit, *packages.Package, bool) {
+	variable, ok := obj.(*types.Var)
+	if !ok || variable.Pkg() == nil {
+		return nil, nil, false
+	}
+
+	varPkg, ok := findImportedPackage(pkg, variable.Pkg().Path())
+	if !ok {
+		return nil, nil, false
+	}
+
+	initExpr, ok := findVarInit(varPkg, variable)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if _, modified := findVarMutation(varPkg, variable); modified {
+		return nil, nil, false
+	}
+
+	return findValue(varPkg, initExpr)
+}
+
+// findVarInit returns the expression variable is initialized with in its declaration.
+func findVarInit(pkg *packages.Package, variable *types.Var) (ast.Expr, bool) {
+	var initExpr ast.Expr
+
+	for _, file := range pkg.Syntax {
+		ast.Inspect(
+			file, func(node ast.Node) bool {
+				switch node.(type) {
+				case *ast.ValueSpec:
+					valueSpec := node.(*ast.ValueSpec)
+					for i, name := range valueSpec.Names {
+						if pkg.TypesInfo.Defs[name] == variable && i < len(valueSpec.Values) {
+							initExpr = valueSpec.Values[i]
+						}
+					}
+				case *ast.AssignStmt:
+					assignStmt := node.(*ast.AssignStmt)
+					if len(assignStmt.Lhs) != len(assignStmt.Rhs) {
+						return true
+					}
+
+					for i, lhs := range assignStmt.Lhs {
+						ident, ok := lhs.(*ast.Ident)
+						if ok && pkg.TypesInfo.Defs[ident] == variable {
+							initExpr = assignStmt.Rhs[i]
+						}
+					}
+				}
+
+				return initExpr == nil
+			},
+		)
+	}
+
+	return initExpr, initExpr != nil
+}
+
+// findVarMutation returns position where function-local variable is assigned, incremented or has its address taken
+// after the declaration, so its value differs from the one it is initialized with. Package-level variables are not
+// tracked. Taking address of the variable passed to BuildConfigs is not a mutation.
+func findVarMutation(pkg *packages.Package, variable *types.Var) (token.Pos, bool) {
+	if variable.Parent() == nil || variable.Parent() == variable.Pkg().Scope() {
+		return token.NoPos, false
+	}
+
+	buildArgs := make(map[ast.Node]bool)
+	pos := token.NoPos
+
+	isVariable := func(expr ast.Expr) bool {
+		ident, ok := rootIdent(expr)
+		return ok && pkg.TypesInfo.Uses[ident] == variable
+	}
+
+	for _, file := range pkg.Syntax {
+		ast.Inspect(
+			file, func(node ast.Node) bool {
+				switch node.(type) {
+				case *ast.CallExpr:
+					callExpr := node.(*ast.CallExpr)
+					if isBuildConfigsCall(pkg.TypesInfo, callExpr) {
+						for _, arg := range callExpr.Args {
+							buildArgs[astutil.Unparen(arg)] = true
+						}
+					}
+				case *ast.AssignStmt:
+					for _, lhs := range node.(*ast.AssignStmt).Lhs {
+						if isVariable(lhs) {
+							pos = lhs.Pos()
+						}
+					}
+				case *ast.IncDecStmt:
+					incDecStmt := node.(*ast.IncDecStmt)
+					if isVariable(incDecStmt.X) {
+						pos = incDecStmt.Pos()
+					}
+				case *ast.UnaryExpr:
+					unaryExpr := node.(*ast.UnaryExpr)
+					if unaryExpr.Op == token.AND && !buildArgs[unaryExpr] && isVariable(unaryExpr.X) {
+						pos = unaryExpr.Pos()
+					}
+				}
+
+				return pos == token.NoPos
+			},
+		)
+	}
+
+	return pos, pos != token.NoPos
+}
+
+// rootIdent returns variable the expression selects from, e.g. c of c.Server.Port or items[0].
+func rootIdent(expr ast.Expr) (*ast.Ident, bool) {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e, true
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		default:
+			return nil, false
+		}
+	}
+}
+
+// namedType resolves type of the config section, following pointers and type aliases.
+func namedType(t types.Type) (*types.Named, bool) {
+	t = unalias(t)
+
+	pointer, ok := t.(*types.Pointer)
+	if ok {
+		t = unalias(pointer.Elem())
+	}
+
+	named, ok := t.(*types.Named)
+
+	return named, ok
+}
+
+// unalias returns the type alias refers to. Aliases are materialized by go/types only since go1.23, the same release
+// Alias.Rhs is introduced in, so the method is looked up dynamically to keep the module go version.
+func unalias(t types.Type) types.Type {
+	for {
+		alias, ok := t.(interface{ Rhs() types.Type })
+		if !ok {
+			return t
+		}
+
+		t = alias.Rhs()
+	}
+}
+
+func findImportedPackage(pkg *packages.Package, pkgPath string) (*packages.Package, bool) {
+	var found *packages.Package
+
+	packages.Visit(
+		[]*packages.Package{pkg}, func(p *packages.Package) bool {
+			if p.PkgPath == pkgPath {
+				found = p
+			}
+
+			return found == nil
+		}, nil,
+	)
+
+	return found, found != nil
+}
+
+func findDeclaration(pkg *packages.Package, name string) (*ast.TypeSpec, bool) {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			if genDecl.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+
+				if typeSpec.Name.Name == name {
+					return typeSpec, true
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+type alias = string
+
+// object is a single config section passed to BuildConfigs.
+type object struct {
+	named *types.Named
+	spec  *ast.TypeSpec
+	// typeExpr refers to the section type from config_gen.go.
+	typeExpr ast.Expr
+	value    *ast.CompositeLit
+	valuePkg *packages.Package
+	// local is set for types declared in config.go. Such types are excluded from regular builds, so their
+	// declarations are copied to config_gen.go.
+	local bool
+}
+
+func (o *object) name() string {
+	return o.named.Obj().Name()
+}
+
+// importedPkg is a package referenced from config_gen.go.
+type importedPkg struct {
+	name  string
+	alias alias
+}
+
+type fileGen struct {
+	pkg       *packages.Package
+	srcFile   *ast.File
+	buildArgs []ast.Expr
+	objects   []*object
+	// localDecls are declarations from config.go that have to be copied to config_gen.go.
+	localDecls []ast.Decl
+	// copied holds type and value specs and functions from localDecls.
+	copied map[ast.Node]bool
+	// imports are packages referenced from config_gen.go by their paths.
+	imports     map[string]*importedPkg
+	diagnostics Diagnostics
+	buf         *bytes.Buffer
+}
+
+func newFileGen(pkg *packages.Package, file *ast.File) *fileGen {
+	return &fileGen{
+		pkg:        pkg,
+		srcFile:    file,
+		buildArgs:  make([]ast.Expr, 0),
+		objects:    make([]*object, 0),
+		localDecls: make([]ast.Decl, 0),
+		copied:     make(map[ast.Node]bool),
+		imports: map[string]*importedPkg{
+			configsPkgPath: {name: "configs", alias: "configs"},
+		},
+		diagnostics: make(Diagnostics, 0),
+		buf:         &bytes.Buffer{},
+	}
+}
+
+// report records diagnostic at the node position. Generation continues, so all problems are reported at once.
+func (f *fileGen) report(node ast.Node, format string, args ...any) {
+	f.diagnostics = append(
+		f.diagnostics, Diagnostic{
+			Pos:     f.pkg.Fset.Position(node.Pos()),
+			Message: fmt.Sprintf(format, args...),
+		},
+	)
+}
+
+// singleObject reports whether the only config section is declared in config.go, in which case its fields are
+// inlined into Config.
+func (f *fileGen) singleObject() bool {
+	return len(f.objects) == 1 && f.objects[0].local
+}
+
+// isLocal reports whether the object is declared in config.go.
+func (f *fileGen) isLocal(obj types.Object) bool {
+	return obj.Pkg() != nil &&
+		obj.Pkg().Path() == f.pkg.PkgPath &&
+		f.pkg.Fset.File(obj.Pos()) == f.pkg.Fset.File(f.srcFile.Pos())
+}
+
+// importName returns the name package is referred by from config_gen.go, registering the import if needed. Aliases
+// from config.go are preferred over package names.
+func (f *fileGen) importName(pkg *types.Package) alias {
+	imported, ok := f.imports[pkg.Path()]
+	if ok {
+		return imported.alias
+	}
+
+	name := pkg.Name()
+	for _, importSpec := range f.srcFile.Imports {
+		if importSpec.Name == nil || importSpec.Name.Name == "." || importSpec.Name.Name == "_" {
+			continue
+		}
+
+		if strings.Trim(importSpec.Path.Value, `"`) == pkg.Path() {
+			name = importSpec.Name.Name
+		}
+	}
+
+	pkgAlias := name
+	for i := 2; f.aliasTaken(pkgAlias); i++ {
+		pkgAlias = fmt.Sprintf("%s%d", name, i)
+	}
+
+	f.imports[pkg.Path()] = &importedPkg{name: pkg.Name(), alias: pkgAlias}
+
+	return pkgAlias
+}
+
+func (f *fileGen) aliasTaken(pkgAlias alias) bool {
+	for _, imported := range f.imports {
+		if imported.alias == pkgAlias {
+			return true
+		}
+	}
+
+	return false
+}
+
+// qualifier is used to print types from config_gen.go.
+func (f *fileGen) qualifier(pkg *types.Package) string {
+	if pkg.Path() == f.pkg.PkgPath {
+		return ""
+	}
+
+	return f.importName(pkg)
+}
+
+// updateDeclarations collects local types required by config sections, tags their fields on every nesting level
+// and records packages that have to be imported by config_gen.go.
+func (f *fileGen) updateDeclarations() error {
+	for _, obj := range f.objects {
+		typeExpr, err := parseExpr(types.TypeString(obj.named, f.qualifier))
+		if err != nil {
+			return err
+		}
+
+		obj.typeExpr = typeExpr
+
+		if f.singleObject() {
+			obj.spec.Type = f.rewriteNode(f.pkg.TypesInfo, obj.spec.Type).(ast.Expr)
+		} else {
+			f.useType(obj.named)
+		}
+
+		for i, elt := range obj.value.Elts {
+			obj.value.Elts[i] = f.rewriteNode(obj.valuePkg.TypesInfo, elt).(ast.Expr)
+		}
+	}
+
+	return nil
+}
+
+// useType registers local types the type refers to, including type arguments of generic types.
+func (f *fileGen) useType(t types.Type) {
+	named, ok := namedType(t)
+	if !ok {
+		return
+	}
+
+	if f.isLocal(named.Obj()) {
+		f.addLocalDecl(named.Obj())
+	}
+
+	typeArgs := named.TypeArgs()
+	for i := 0; i < typeArgs.Len(); i++ {
+		f.useType(typeArgs.At(i))
+	}
+}
+
+// addLocalDecl copies declaration of the package level object from config.go to config_gen.go.
+func (f *fileGen) addLocalDecl(obj types.Object) {
+	for _, decl := range f.srcFile.Decls {
+		switch decl.(type) {
+		case *ast.FuncDecl:
+			funcDecl := decl.(*ast.FuncDecl)
+			if funcDecl.Recv != nil || f.pkg.TypesInfo.Defs[funcDecl.Name] != obj || f.copied[funcDecl] {
+				continue
+			}
+
+			// declaration is added before rewriting, so it precedes declarations it depends on
+			f.copied[funcDecl] = true
+			f.localDecls = append(f.localDecls, funcDecl)
+			f.rewriteNode(f.pkg.TypesInfo, funcDecl)
+
+			return
+		case *ast.GenDecl:
+			genDecl := decl.(*ast.GenDecl)
+			for _, spec := range genDecl.Specs {
+				if !f.declares(spec, obj) || f.copied[spec] {
+					continue
+				}
+
+				copiedDecl := &ast.GenDecl{
+					TokPos: genDecl.TokPos,
+					Tok:    genDecl.Tok,
+					Specs:  []ast.Spec{spec},
+				}
+
+				if len(genDecl.Specs) == 1 {
+					copiedDecl.Doc = genDecl.Doc
+				}
+
+				f.copied[spec] = true
+				f.localDecls = append(f.localDecls, copiedDecl)
+				f.rewriteNode(f.pkg.TypesInfo, spec)
+
+				return
+			}
+		}
+	}
+}
+
+func (f *fileGen) declares(spec ast.Spec, obj types.Object) bool {
+	switch spec.(type) {
+	case *ast.TypeSpec:
+		return f.pkg.TypesInfo.Defs[spec.(*ast.TypeSpec).Name] == obj
+	case *ast.ValueSpec:
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			if f.pkg.TypesInfo.Defs[name] == obj {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// copyable reports whether the declaration of the constant could be copied as is. Constants relying on implicit
+// repetition of the previous expression or on iota are replaced with their values instead.
+func (f *fileGen) copyable(constant *types.Const) bool {
+	for _, decl := range f.srcFile.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+
+		for _, spec := range genDecl.Specs {
+			if !f.declares(spec, constant) {
+				continue
+			}
+
+			valueSpec := spec.(*ast.ValueSpec)
+			if len(valueSpec.Values) != len(valueSpec.Names) {
+				return false
+			}
+
+			usesIota := false
+			ast.Inspect(
+				valueSpec, func(node ast.Node) bool {
+					ident, ok := node.(*ast.Ident)
+					if ok && f.pkg.TypesInfo.Uses[ident] == types.Universe.Lookup("iota") {
+						usesIota = true
+					}
+
+					return !usesIota
+				},
+			)
+
+			return !usesIota
+		}
+	}
+
+	return false
+}
+
+// rewriteNode prepares AST from the package sources to be printed in config_gen.go: tags fields of all structs,
+// qualifies identifiers with names packages are imported by in config_gen.go and copies local declarations node
+// depends on. Identifiers, that could not be referred from config_gen.go, are replaced with constant values or
+// expressions variables are initialized with.
+func (f *fileGen) rewriteNode(info *types.Info, node ast.Node) ast.Node {
+	root := node
+
+	return astutil.Apply(
+		node, func(cursor *astutil.Cursor) bool {
+			switch cursor.Node().(type) {
+			case *ast.StructType:
+				tagStructFields(cursor.Node().(*ast.StructType))
+			case *ast.SelectorExpr:
+				selectorExpr := cursor.Node().(*ast.SelectorExpr)
+
+				xIdent, ok := selectorExpr.X.(*ast.Ident)
+				if !ok {
+					return true
+				}
+
+				_, ok = info.Uses[xIdent].(*types.PkgName)
+				if !ok {
+					return true
+				}
+
+				cursor.Replace(f.rewriteObject(selectorExpr, info.Uses[selectorExpr.Sel]))
+
+				return false
+			case *ast.Ident:
+				ident := cursor.Node().(*ast.Ident)
+
+				obj := info.Uses[ident]
+				if obj == nil || obj.Pkg() == nil || obj.Parent() == nil {
+					// definitions, builtins, struct fields and methods are left as is
+					return true
+				}
+
+				if obj.Parent() != obj.Pkg().Scope() && root.Pos() <= obj.Pos() && obj.Pos() < root.End() {
+					// declared inside the node itself
+					return true
+				}
+
+				cursor.Replace(f.rewriteObject(ident, obj))
+
+				return false
+			}
+
+			return true
+		}, nil,
+	)
+}
+
+// rewriteObject returns expression referring to the object from config_gen.go.
+func (f *fileGen) rewriteObject(expr ast.Expr, obj types.Object) ast.Expr {
+	constant, isConst := obj.(*types.Const)
+
+	switch {
+	case obj.Parent() != obj.Pkg().Scope():
+		// declared in function scope
+		if isConst {
+			return f.constExpr(constant)
+		}
+
+		variable, ok := obj.(*types.Var)
+		if !ok {
+			break
+		}
+
+		initPkg, ok := findImportedPackage(f.pkg, variable.Pkg().Path())
+		if !ok {
+			break
+		}
+
+		initExpr, ok := findVarInit(initPkg, variable)
+		if !ok {
+			break
+		}
 
-	err = inspectSrc(gen)
-	if err != nil {
-		return err
-	}
+		if pos, modified := findVarMutation(initPkg, variable); modified {
+			f.report(
+				expr, "could not resolve %s in default value, it is modified after declaration at line %d",
+				types.ExprString(expr), initPkg.Fset.Position(pos).Line,
+			)
 
-	gen.updateDeclarations()
+			return expr
+		}
 
-	err = gen.generateFile()
-	if err != nil {
-		return err
-	}
+		inlined := f.rewriteNode(initPkg.TypesInfo, initExpr).(ast.Expr)
+		resetPositions(inlined)
 
-	err = writeFormattedFile(rootDir, gen)
-	if err != nil {
-		return err
-	}
+		return parenthesize(inlined)
+	case f.isLocal(obj):
+		if isConst && !f.copyable(constant) {
+			return f.constExpr(constant)
+		}
 
-	return nil
-}
+		f.addLocalDecl(obj)
 
-func joinPackageErrors(pkg *packages.Package) error {
-	if len(pkg.Errors) > 0 {
-		errs := make([]error, len(pkg.Errors))
+		return ast.NewIdent(obj.Name())
+	case obj.Pkg().Path() != f.pkg.PkgPath:
+		// declared in the package of the value, dot-imported or qualified by the package name
+		if isConst && !obj.Exported() {
+			return f.constExpr(constant)
+		}
 
-		for i := range pkg.Errors {
-			errs[i] = pkg.Errors[i]
+		if !obj.Exported() {
+			break
 		}
 
-		return errors.Join(errs...)
+		return &ast.SelectorExpr{
+			X:   ast.NewIdent(f.importName(obj.Pkg())),
+			Sel: ast.NewIdent(obj.Name()),
+		}
+	default:
+		return ast.NewIdent(obj.Name())
 	}
 
-	return nil
+	f.report(expr, "could not resolve %s in default value", types.ExprString(expr))
+
+	return expr
 }
 
-func getSrcFile(pkg *packages.Package) (*ast.File, error) {
-	if len(pkg.Syntax) < 1 {
-		return nil, errors.New("srcFile not found")
+// constExpr returns literal of the constant value converted to the constant type unless it is a basic one.
+func (f *fileGen) constExpr(c *types.Const) ast.Expr {
+	value := c.Val()
+
+	lit := value.ExactString()
+	if value.Kind() == constant.Float {
+		floatValue, _ := constant.Float64Val(value)
+		lit = strconv.FormatFloat(floatValue, 'g', -1, 64)
 	}
 
-	return pkg.Syntax[0], nil
-}
+	expr, err := parseExpr(lit)
+	if err != nil {
+		expr = &ast.BasicLit{Value: lit}
+	}
 
-func findPackage(rootDir string) (*packages.Package, error) {
-	fileset := token.NewFileSet()
+	_, isBasic := unalias(c.Type()).(*types.Basic)
+	if isBasic {
+		return parenthesize(expr)
+	}
 
-	parsedPackages, err := packages.Load(
-		&packages.Config{
-			Mode:       packages.NeedImports | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedCompiledGoFiles | packages.NeedDeps | packages.NeedModule,
-			Context:    context.TODO(),
-			Dir:        rootDir,
-			BuildFlags: []string{"-tags=vanya"},
-			Fset:       fileset,
-			Tests:      true,
-		}, ConfigSrcFileName,
-	)
+	f.useType(c.Type())
+
+	typeExpr, err := parseExpr(types.TypeString(c.Type(), f.qualifier))
 	if err != nil {
-		return nil, err
+		return parenthesize(expr)
 	}
 
-	if len(parsedPackages) == 0 {
-		return nil, errors.New("unable to find package")
+	return &ast.CallExpr{
+		Fun:  typeExpr,
+		Args: []ast.Expr{expr},
 	}
+}
 
-	if len(parsedPackages) > 1 {
-		return nil, errors.New("multiple packages found with config.go srcFile")
+// parseExpr parses expression built by the generator. Positions of the expression are reset as they do not belong to
+// the package file set.
+func parseExpr(src string) (ast.Expr, error) {
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, err
 	}
 
-	return parsedPackages[0], nil
+	resetPositions(expr)
+
+	return expr, nil
 }
 
-func inspectSrc(gen *fileGen) error {
-	errs := make([]error, 0)
+var posType = reflect.TypeOf(token.NoPos)
 
+// resetPositions clears positions of all nodes in the tree, so printer does not break lines according to the
+// original source when the node is inlined into the generated code.
+func resetPositions(node ast.Node) {
 	ast.Inspect(
-		gen.srcFile, func(node ast.Node) bool {
-			var err error
-
-			switch node.(type) {
-			case *ast.FuncDecl:
-				err = inspectMain(gen, node.(*ast.FuncDecl))
-			case *ast.ImportSpec:
-				err = inspectImport(gen, node.(*ast.ImportSpec))
+		node, func(n ast.Node) bool {
+			if n == nil {
+				return false
 			}
 
-			if err != nil {
-				errs = append(errs, err)
+			value := reflect.ValueOf(n).Elem()
+			for i := 0; i < value.NumField(); i++ {
+				if value.Field(i).Type() == posType {
+					value.Field(i).Set(reflect.ValueOf(token.NoPos))
+				}
 			}
 
 			return true
 		},
 	)
-
-	err := errors.Join(errs...)
-	if err != nil {
-		return err
-	}
-
-	for _, arg := range gen.buildArgs {
-		inspectTypes(gen, arg)
-	}
-
-	return nil
 }
 
-func inspectImport(gen *fileGen, node *ast.ImportSpec) error {
-	pkg, ok := gen.pkg.Imports[strings.Trim(node.Path.Value, `"`)]
-	if !ok {
-		return fmt.Errorf("imported package %s not found", node.Path.Value)
-	}
-
-	pkgName := pkg.Types.Name()
-
-	if node.Name != nil {
-		pkgName = node.Name.Name
+// parenthesize wraps the expression into parentheses unless it is an operand, so it could be inlined into another
+// expression.
+func parenthesize(expr ast.Expr) ast.Expr {
+	switch expr.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr:
+		return &ast.ParenExpr{X: expr}
 	}
 
-	gen.imports[pkgName] = pkg
-
-	return nil
+	return expr
 }
 
-func inspectMain(gen *fileGen, node *ast.FuncDecl) error {
-	if node.Name.Name != "main" {
-		return nil
-	}
-
-	if node.Body == nil || node.Body.List == nil {
-		return errors.New("invalid main function body")
-	}
-
-	for _, statement := range node.Body.List {
-		exprStmt, ok := statement.(*ast.ExprStmt)
-		if !ok {
-			continue
-		}
-
-		callExpr, ok := exprStmt.X.(*ast.CallExpr)
-		if !ok {
-			continue
-		}
-
-		selectorExpr, ok := callExpr.Fun.(*ast.SelectorExpr)
-		if !ok {
-			continue
-		}
-
-		callIdent, ok := selectorExpr.X.(*ast.Ident)
-		if !ok {
-			continue
-		}
+// tagStructFields adds mapstructure tag to every exported field of the struct. Fields declared with multiple names
+// are split, so each of them gets its own key. Embedded structs are squashed into the parent. Field comments are
+// copied to usage tag, which is used as flag usage text.
+func tagStructFields(structType *ast.StructType) {
+	fields := make([]*ast.Field, 0, len(structType.Fields.List))
 
-		if callIdent.Name != "vanya" && selectorExpr.Sel.Name != "BuildConfigs" {
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			field.Tag = mergeTag(field.Tag, "mapstructure", embeddedFieldKey(field.Type))
+			fields = append(fields, field)
 			continue
 		}
 
-		gen.buildArgs = callExpr.Args
-	}
-
-	return nil
-}
-
-func inspectTypes(gen *fileGen, arg ast.Expr) {
-	switch arg.(type) {
-	case *ast.UnaryExpr:
-		inspectTypes(gen, arg.(*ast.UnaryExpr).X)
-	case *ast.CompositeLit:
-		compositeLit, ok := arg.(*ast.CompositeLit)
-		if !ok {
-			log.Println("only composite literals are expected as argument in BuildConfig")
-			return
-		}
-
-		switch compositeLit.Type.(type) {
-		case *ast.SelectorExpr:
-			selectorExpr := compositeLit.Type.(*ast.SelectorExpr)
-			xIdent, ok := selectorExpr.X.(*ast.Ident)
-			if !ok {
-				return
+		for i, name := range field.Names {
+			splitField := &ast.Field{
+				Names: []*ast.Ident{name},
+				Type:  field.Type,
 			}
 
-			pkg, ok := gen.imports[xIdent.Name]
-			if !ok {
-				log.Printf("could not find package providing %s.%s\n", xIdent.Name, selectorExpr.Sel.Name)
-				return
+			if i == 0 {
+				splitField.Doc = field.Doc
 			}
 
-			decl, ok := findDeclaration(pkg, selectorExpr.Sel.Name)
-			if !ok {
-				log.Printf("could not find declaration %s.%s in imported package", xIdent.Name, selectorExpr.Sel.Name)
-				return
+			if i == len(field.Names)-1 {
+				splitField.Comment = field.Comment
 			}
 
-			gen.objects = append(gen.objects, decl)
-		case *ast.Ident:
-			name := compositeLit.Type.(*ast.Ident).Name
+			splitField.Tag = field.Tag
+			if name.IsExported() {
+				splitField.Tag = mergeTag(field.Tag, "mapstructure", toSnakeCase(name.Name))
 
-			decl, ok := findDeclaration(gen.pkg, name)
-			if !ok {
-				log.Printf("could not find declaration for %s", name)
-				return
+				if usage := fieldUsage(splitField); usage != "" {
+					splitField.Tag = mergeTag(splitField.Tag, "usage", usage)
+				}
 			}
 
-			gen.objects = append(gen.objects, decl)
+			fields = append(fields, splitField)
 		}
-
-		return
 	}
+
+	structType.Fields.List = fields
 }
 
-func findDeclaration(pkg *packages.Package, name string) (ast.Decl, bool) {
-	for _, file := range pkg.Syntax {
-		for _, decl := range file.Decls {
-			genDecl, ok := decl.(*ast.GenDecl)
-			if !ok {
-				continue
-			}
+// fieldUsage returns doc or line comment of the field joined into a single line. Fields split from a declaration with
+// multiple names share the comments, so only the first one gets doc and only the last one gets line comment.
+func fieldUsage(field *ast.Field) string {
+	text := field.Doc.Text()
+	if text == "" {
+		text = field.Comment.Text()
+	}
 
-			if genDecl.Tok != token.TYPE {
-				continue
-			}
+	return strings.Join(strings.Fields(text), " ")
+}
 
-			for _, spec := range genDecl.Specs {
-				typeSpec, ok := spec.(*ast.TypeSpec)
-				if !ok {
-					continue
-				}
+// embeddedFieldKey returns mapstructure key for the embedded field. Only structs could be squashed, so embedded
+// pointers are decoded as regular fields named after their type.
+func embeddedFieldKey(fieldType ast.Expr) string {
+	starExpr, ok := fieldType.(*ast.StarExpr)
+	if !ok {
+		return ",squash"
+	}
 
-				if typeSpec.Name.Name == name {
-					return decl, true
-				}
-			}
-		}
+	switch starExpr.X.(type) {
+	case *ast.Ident:
+		return toSnakeCase(starExpr.X.(*ast.Ident).Name)
+	case *ast.SelectorExpr:
+		return toSnakeCase(starExpr.X.(*ast.SelectorExpr).Sel.Name)
 	}
 
-	return nil, false
+	return ",squash"
 }
 
-type alias = string
+// mergeTag adds key with value to the field tag, keeping other keys. Explicitly set key is left as is.
+func mergeTag(tag *ast.BasicLit, key, value string) *ast.BasicLit {
+	tagValue := ""
+	if tag != nil {
+		var err error
 
-type fileGen struct {
-	pkg       *packages.Package
-	srcFile   *ast.File
-	imports   map[alias]*packages.Package
-	buildArgs []ast.Expr
-	objects   []ast.Decl
-	buf       *bytes.Buffer
-}
+		tagValue, err = strconv.Unquote(tag.Value)
+		if err != nil {
+			return tag
+		}
 
-func newFileGen(pkg *packages.Package, file *ast.File) *fileGen {
-	return &fileGen{
-		pkg:       pkg,
-		srcFile:   file,
-		imports:   make(map[alias]*packages.Package),
-		buildArgs: make([]ast.Expr, 0),
-		objects:   make([]ast.Decl, 0),
-		buf:       &bytes.Buffer{},
-	}
-}
-
-func (f *fileGen) updateDeclarations() {
-	for _, decl := range f.objects {
-		typeSpec := decl.(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
-		structType := typeSpec.Type.(*ast.StructType)
-		for _, field := range structType.Fields.List {
-			field.Tag = &ast.BasicLit{
-				Value: fmt.Sprintf("`mapstructure:\"%s\"`", toSnakeCase(field.Names[0].Name)),
-			}
+		_, ok := reflect.StructTag(tagValue).Lookup(key)
+		if ok {
+			return tag
 		}
 	}
+
+	tagValue = strings.TrimSpace(fmt.Sprintf(`%s %s:%s`, tagValue, key, strconv.Quote(value)))
+
+	quoted := "`" + tagValue + "`"
+	if strings.Contains(tagValue, "`") {
+		quoted = strconv.Quote(tagValue)
+	}
+
+	lit := &ast.BasicLit{
+		Kind:  token.STRING,
+		Value: quoted,
+	}
+
+	if tag != nil {
+		lit.ValuePos = tag.ValuePos
+	}
+
+	return lit
 }
 
 func (f *fileGen) generateFile() error {
@@ -324,6 +1150,11 @@ func (f *fileGen) generateFile() error {
 		return err
 	}
 
+	err = f.generateLocalDecls()
+	if err != nil {
+		return err
+	}
+
 	err = f.generateConfigConstructor()
 	if err != nil {
 		return err
@@ -339,8 +1170,8 @@ func (f *fileGen) generateFile() error {
 
 const frameFormat = `// Code generated by Vanya: DO NOT EDIT.
 // versions:
-// 	vanya v0.0.0
-// source: github.com/ivanmashin/my-service/configs/config.go
+// 	vanya %s
+// source: %s
 
 //go:generate go run github.com/ivanmashin/vanya/cmd/configs
 //go:build !vanya
@@ -348,11 +1179,83 @@ const frameFormat = `// Code generated by Vanya: DO NOT EDIT.
 
 package %s
 
-import "github.com/ivanmashin/vanya/pkg/configs"
 `
 
+const develVersion = "(devel)"
+
+// vanyaVersion returns version of vanya module the generator is built from.
+func vanyaVersion() string {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return develVersion
+	}
+
+	version := ""
+	if buildInfo.Main.Path == vanyaPkgPath {
+		version = buildInfo.Main.Version
+	}
+
+	for _, dep := range buildInfo.Deps {
+		if dep.Path != vanyaPkgPath {
+			continue
+		}
+
+		version = dep.Version
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			version = dep.Replace.Version
+		}
+	}
+
+	if version == "" {
+		return develVersion
+	}
+
+	return version
+}
+
+const configsPkgPath = "github.com/ivanmashin/vanya/pkg/configs"
+
 func (f *fileGen) generateFrame() error {
-	_, err := f.buf.WriteString(fmt.Sprintf(frameFormat, f.pkg.Types.Name()))
+	source := path.Join(f.pkg.PkgPath, ConfigSrcFileName)
+
+	_, err := f.buf.WriteString(fmt.Sprintf(frameFormat, vanyaVersion(), source, f.pkg.Types.Name()))
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(f.imports))
+	for pkgPath := range f.imports {
+		paths = append(paths, pkgPath)
+	}
+
+	sort.Strings(paths)
+
+	importDecl := &ast.GenDecl{
+		Tok:   token.IMPORT,
+		Specs: make([]ast.Spec, 0, len(paths)),
+	}
+
+	for _, pkgPath := range paths {
+		imported := f.imports[pkgPath]
+
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(pkgPath)}}
+		if imported.alias != imported.name {
+			spec.Name = ast.NewIdent(imported.alias)
+		}
+
+		importDecl.Specs = append(importDecl.Specs, spec)
+	}
+
+	if len(importDecl.Specs) > 1 {
+		importDecl.Lparen = 1
+	}
+
+	err = printer.Fprint(f.buf, f.pkg.Fset, importDecl)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.buf.WriteString("\n\n")
 	if err != nil {
 		return err
 	}
@@ -361,11 +1264,11 @@ func (f *fileGen) generateFrame() error {
 }
 
 func (f *fileGen) generateConfig() error {
-	if len(f.objects) == 1 {
+	if f.singleObject() {
 		return f.generateConfigSingleObject()
 	}
 
-	fields := 1 + len(f.objects)*2 // = 1 embeddingField + (1 field + 1 space)*len(objects)
+	fields := 2 + len(f.objects) // = 1 embeddingField + 1 space + 1 field per object
 	fieldList := make([]*ast.Field, fields)
 	fieldList[0] = &ast.Field{
 		Type: &ast.SelectorExpr{
@@ -373,6 +1276,9 @@ func (f *fileGen) generateConfig() error {
 			Sel: ast.NewIdent("Embedding"),
 		},
 	}
+	fieldList[1] = &ast.Field{
+		Type: ast.NewIdent(""),
+	}
 
 	cfgObj := &ast.GenDecl{
 		Tok: token.TYPE,
@@ -389,20 +1295,13 @@ func (f *fileGen) generateConfig() error {
 	}
 
 	for i, obj := range f.objects {
-		genDecl := obj.(*ast.GenDecl)
-		spec := genDecl.Specs[0].(*ast.TypeSpec)
-
-		fieldList[i*2+1] = &ast.Field{
-			Type: ast.NewIdent(""),
-		}
-
-		fieldList[i*2+2] = &ast.Field{
+		fieldList[i+2] = &ast.Field{
 			Names: []*ast.Ident{
-				ast.NewIdent(spec.Name.Name),
+				ast.NewIdent(obj.name()),
 			},
-			Type: spec.Type,
+			Type: obj.typeExpr,
 			Tag: &ast.BasicLit{
-				Value: fmt.Sprintf("`mapstructure:\"%s\"`", toSnakeCase(spec.Name.Name)),
+				Value: fmt.Sprintf("`mapstructure:\"%s\"`", toSnakeCase(obj.name())),
 			},
 		}
 	}
@@ -415,15 +1314,39 @@ func (f *fileGen) generateConfig() error {
 	return nil
 }
 
+// generateLocalDecls copies declarations from config.go, which is only compiled with vanya tag.
+func (f *fileGen) generateLocalDecls() error {
+	for _, decl := range f.localDecls {
+		_, err := f.buf.WriteString("\n\n")
+		if err != nil {
+			return err
+		}
+
+		err = printer.Fprint(f.buf, f.pkg.Fset, decl)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (f *fileGen) generateConfigSingleObject() error {
-	cfgObj := f.objects[0]
+	spec := &ast.TypeSpec{
+		Name: ast.NewIdent("Config"),
+		Type: f.objects[0].spec.Type,
+	}
 
-	genDecl := cfgObj.(*ast.GenDecl)
-	spec := genDecl.Specs[0].(*ast.TypeSpec)
+	cfgObj := &ast.GenDecl{
+		Tok:   token.TYPE,
+		Specs: []ast.Spec{spec},
+	}
 
-	spec.Name = ast.NewIdent("Config")
+	structSpec, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return errors.New("received single non-struct type")
+	}
 
-	structSpec := spec.Type.(*ast.StructType)
 	fieldList := []*ast.Field{
 		{
 			Type: &ast.SelectorExpr{
@@ -436,17 +1359,14 @@ func (f *fileGen) generateConfigSingleObject() error {
 		},
 	}
 
-	structSpec.Fields.List = append(fieldList, structSpec.Fields.List...)
-
-	if len(structSpec.Fields.List) == 2 {
+	if len(structSpec.Fields.List) == 0 {
 		return errors.New("received single empty struct")
 	}
 
-	for i := 2; i < len(structSpec.Fields.List); i++ {
-		field := structSpec.Fields.List[i]
-		field.Tag = &ast.BasicLit{
-			Value: fmt.Sprintf("`mapstructure:\"%s\"`", toSnakeCase(field.Names[0].Name)),
-		}
+	spec.Type = &ast.StructType{
+		Fields: &ast.FieldList{
+			List: append(fieldList, structSpec.Fields.List...),
+		},
 	}
 
 	err := printer.Fprint(f.buf, f.pkg.Fset, cfgObj)
@@ -512,32 +1432,22 @@ type templateData struct {
 
 func (f *fileGen) generateDefaultConstructor() error {
 	cfgTemplate := defaultConfigTemplate
-	if len(f.objects) == 1 {
+	if f.singleObject() {
 		cfgTemplate = defaultConfigSingleObjTemplate
 	}
 
 	data := make([]templateData, 0)
 
-	for i, obj := range f.objects {
-		genDecl := obj.(*ast.GenDecl)
-		spec := genDecl.Specs[0].(*ast.TypeSpec)
-
-		structType, ok := spec.Type.(*ast.StructType)
-		if ok {
-			removeAllCommentsFromStruct(structType)
-		}
-
-		mainFuncArg := f.buildArgs[i].(*ast.CompositeLit)
-
+	for _, obj := range f.objects {
 		bt := &bytes.Buffer{}
-		err := printer.Fprint(bt, f.pkg.Fset, spec.Type)
+		err := printer.Fprint(bt, f.pkg.Fset, obj.typeExpr)
 		if err != nil {
 			return err
 		}
 
 		defaults := make([]string, 0)
 		b := &bytes.Buffer{}
-		for _, expr := range mainFuncArg.Elts {
+		for _, expr := range obj.value.Elts {
 			err := printer.Fprint(b, f.pkg.Fset, expr)
 			if err != nil {
 				return err
@@ -549,7 +1459,7 @@ func (f *fileGen) generateDefaultConstructor() error {
 
 		data = append(
 			data, templateData{
-				Key: spec.Name.Name, Type: bt.String(), Defaults: defaults,
+				Key: obj.name(), Type: bt.String(), Defaults: defaults,
 			},
 		)
 	}
@@ -564,30 +1474,86 @@ func (f *fileGen) generateDefaultConstructor() error {
 	return nil
 }
 
-func removeAllCommentsFromStruct(node *ast.StructType) {
-	for _, field := range node.Fields.List {
-		field.Doc = nil
-		field.Comment = nil
+// writeFile atomically replaces the file with the generated source, keeping permissions of the existing file. File
+// is left untouched if its content is up to date, so build caches and file watchers are not invalidated.
+func writeFile(dstPath string, src []byte) error {
+	perm := fs.FileMode(0644)
+
+	info, err := os.Stat(dstPath)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+
+		current, err := os.ReadFile(dstPath)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(current, src) {
+			return nil
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
 	}
-}
 
-func writeFormattedFile(rootDir string, gen *fileGen) error {
-	f, err := os.OpenFile(filepath.Join(rootDir, ConfigDstFileName), os.O_CREATE|os.O_WRONLY, 0666)
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".*.tmp")
 	if err != nil {
 		return err
 	}
 
-	src, err := format.Source(gen.buf.Bytes())
+	defer func() {
+		// no-op when the file is renamed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = io.Copy(tmp, bytes.NewReader(src))
 	if err != nil {
+		_ = tmp.Close()
 		return err
 	}
 
-	_, err = io.Copy(f, bytes.NewReader(src))
+	err = tmp.Chmod(perm)
 	if err != nil {
+		_ = tmp.Close()
 		return err
 	}
 
-	return nil
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dstPath)
+}
+
+// checkFile compares generated source with the file on disk, writing unified diff to w if they differ. Missing file
+// is compared as an empty one.
+func checkFile(dstPath string, src []byte, w io.Writer) error {
+	current, err := os.ReadFile(dstPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if bytes.Equal(current, src) {
+		return nil
+	}
+
+	if w != nil {
+		err = difflib.WriteUnifiedDiff(
+			w, difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(current)),
+				B:        difflib.SplitLines(string(src)),
+				FromFile: dstPath,
+				ToFile:   dstPath + " (generated)",
+				Context:  3,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%s: %w", dstPath, ErrOutdated)
 }
 
 var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
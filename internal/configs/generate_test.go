@@ -1,10 +1,12 @@
 package configs
 
 import (
+	"bytes"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestGenerate_SingleObj(t *testing.T) {
@@ -32,3 +34,214 @@ func TestGenerate_MultipleObj(t *testing.T) {
 	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
 	assert.Equal(t, string(refData), string(data))
 }
+
+func TestGenerate_ImportedObj(t *testing.T) {
+	rootDir := "./test-data/imported-obj"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.Equal(t, string(refData), string(data))
+}
+
+func TestGenerate_NestedObj(t *testing.T) {
+	rootDir := "./test-data/nested-obj"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.Equal(t, string(refData), string(data))
+}
+
+func TestGenerate_ResolvedObjs(t *testing.T) {
+	rootDir := "./test-data/resolved-objs"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.Equal(t, string(refData), string(data))
+}
+
+func TestGenerate_DefaultsObj(t *testing.T) {
+	rootDir := "./test-data/defaults-obj"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.Equal(t, string(refData), string(data))
+}
+
+func TestGenerate_TaggedObj(t *testing.T) {
+	rootDir := "./test-data/tagged-obj"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.Equal(t, string(refData), string(data))
+}
+
+func TestGenerate_Check(t *testing.T) {
+	rootDir := "./test-data/single-obj"
+
+	err := Generate(rootDir)
+	assert.NoError(t, err)
+
+	diff := &bytes.Buffer{}
+	err = Generate(rootDir, WithCheck(diff))
+	assert.NoError(t, err)
+	assert.Empty(t, diff.String())
+
+	stale := "//go:build !vanya\n\npackage single_obj\n"
+	err = os.WriteFile(path.Join(rootDir, "config_gen.go"), []byte(stale), 0666)
+	assert.NoError(t, err)
+
+	err = Generate(rootDir, WithCheck(diff))
+	assert.ErrorIs(t, err, ErrOutdated)
+	assert.Contains(t, diff.String(), "+type Config struct {")
+
+	data, err := os.ReadFile(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, stale, string(data))
+
+	err = os.Remove(path.Join(rootDir, "config_gen.go"))
+	assert.NoError(t, err)
+
+	err = Generate(rootDir)
+	assert.NoError(t, err)
+}
+
+func TestGenerate_Patterns(t *testing.T) {
+	rootDir := "./test-data"
+
+	err := Generate(rootDir, WithPatterns("./..."))
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(rootDir)
+	assert.NoError(t, err)
+
+	for _, entry := range entries {
+		data, err := os.ReadFile(path.Join(rootDir, entry.Name(), "config_gen.go"))
+		assert.NoError(t, err)
+
+		refData, err := os.ReadFile(path.Join(rootDir, entry.Name(), "ref/config_gen.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, string(refData), string(data), entry.Name())
+	}
+}
+
+func TestGenerate_PackageErrors(t *testing.T) {
+	err := Generate("./test-data/single-obj/ref")
+	assert.Error(t, err)
+
+	err = Generate("./test-data", WithPatterns("./single-obj", "./does-not-exist"))
+
+	var pkgErr *PackageError
+	assert.ErrorAs(t, err, &pkgErr)
+	assert.Contains(t, pkgErr.PkgPath, "does-not-exist")
+}
+
+func TestGenerate_Write(t *testing.T) {
+	rootDir := "./test-data/single-obj"
+	dstPath := path.Join(rootDir, "config_gen.go")
+
+	refData, err := os.ReadFile(path.Join(rootDir, "ref/config_gen.go"))
+	assert.NoError(t, err)
+
+	// previous content is longer than the generated one
+	err = os.WriteFile(dstPath, append(refData, refData...), 0600)
+	assert.NoError(t, err)
+
+	err = os.Chmod(dstPath, 0600)
+	assert.NoError(t, err)
+
+	err = Generate(rootDir)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(dstPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(refData), string(data))
+
+	info, err := os.Stat(dstPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(dstPath, modTime, modTime)
+	assert.NoError(t, err)
+
+	err = Generate(rootDir)
+	assert.NoError(t, err)
+
+	info, err = os.Stat(dstPath)
+	assert.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+
+	err = os.Chmod(dstPath, 0644)
+	assert.NoError(t, err)
+}
+
+func TestGenerate_Diagnostics(t *testing.T) {
+	rootDir := "./test-data-invalid/unresolved-obj"
+
+	err := Generate(rootDir)
+
+	var diagnostics Diagnostics
+	assert.ErrorAs(t, err, &diagnostics)
+	assert.Len(t, diagnostics, 2)
+
+	for _, d := range diagnostics {
+		assert.Equal(t, ConfigSrcFileName, path.Base(d.Pos.Filename))
+	}
+
+	assert.Equal(t, 10, diagnostics[0].Pos.Line)
+	assert.Equal(t, 3, diagnostics[0].Pos.Column)
+	assert.Contains(t, diagnostics[0].String(), "config.go:10:3: only composite literals")
+	assert.Equal(t, 14, diagnostics[1].Pos.Line)
+	assert.Contains(t, diagnostics[1].Message, "duplicate config section MyConfig")
+
+	_, err = os.Stat(path.Join(rootDir, ConfigDstFileName))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestGenerate_ModifiedVariables(t *testing.T) {
+	rootDir := "./test-data-invalid/modified-var"
+
+	err := Generate(rootDir)
+
+	var diagnostics Diagnostics
+	assert.ErrorAs(t, err, &diagnostics)
+	assert.Len(t, diagnostics, 4)
+
+	// arguments are inspected before default values are rewritten
+	assert.Equal(t, 27, diagnostics[0].Pos.Line)
+	assert.Contains(t, diagnostics[0].Message, "only composite literals or variables initialized with them")
+	assert.Equal(t, 23, diagnostics[1].Pos.Line)
+	assert.Contains(t, diagnostics[1].Message, "could not resolve retries in default value, it is modified after declaration at line 10")
+	assert.Equal(t, 24, diagnostics[2].Pos.Line)
+	assert.Contains(t, diagnostics[2].Message, "could not resolve attempts in default value, it is modified after declaration at line 13")
+	assert.Equal(t, 25, diagnostics[3].Pos.Line)
+	assert.Contains(t, diagnostics[3].Message, "could not resolve timeout in default value, it is modified after declaration at line 16")
+
+	_, err = os.Stat(path.Join(rootDir, ConfigDstFileName))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
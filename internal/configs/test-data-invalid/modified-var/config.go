@@ -0,0 +1,43 @@
+//go:build vanya
+// +build vanya
+
+package modified_var
+
+import "github.com/ivanmashin/vanya"
+
+func main() {
+	retries := 3
+	retries = 10
+
+	attempts := 1
+	attempts++
+
+	timeout := 5
+	setTimeout(&timeout)
+
+	server := ServerConfig{}
+	server.Port = 8080
+
+	vanya.BuildConfigs(
+		RetryConfig{
+			Retries:  retries,
+			Attempts: attempts,
+			Timeout:  timeout,
+		},
+		server,
+	)
+}
+
+func setTimeout(timeout *int) {
+	*timeout = 10
+}
+
+type RetryConfig struct {
+	Retries  int
+	Attempts int
+	Timeout  int
+}
+
+type ServerConfig struct {
+	Port int
+}
@@ -0,0 +1,26 @@
+//go:build vanya
+// +build vanya
+
+package unresolved_obj
+
+import "github.com/ivanmashin/vanya"
+
+func main() {
+	vanya.BuildConfigs(
+		newConfig(),
+		MyConfig{
+			Endpoint: "localhost:51000",
+		},
+		MyConfig{
+			Endpoint: "localhost:52000",
+		},
+	)
+}
+
+func newConfig() MyConfig {
+	return MyConfig{}
+}
+
+type MyConfig struct {
+	Endpoint string
+}
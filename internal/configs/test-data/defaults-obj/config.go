@@ -0,0 +1,67 @@
+//go:build vanya
+// +build vanya
+
+package defaults_obj
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ivanmashin/vanya"
+	"github.com/ivanmashin/vanya/pkg/configs"
+)
+
+const defaultPort = 8080
+
+const defaultTimeout = 5 * time.Second
+
+var defaultHost = envOr("HOST", "localhost")
+
+func envOr(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+func main() {
+	const ratio = 0.75
+
+	retries := 3 * 2
+
+	vanya.BuildConfigs(
+		ServerConfig{
+			Host:        defaultHost,
+			Port:        defaultPort + 1,
+			Timeout:     defaultTimeout,
+			ReadTimeout: 2 * time.Second,
+			User:        os.Getenv("USER"),
+			Retries:     retries + 1,
+			Ratio:       ratio,
+			Level:       levelDebug,
+		},
+		configs.LoggerConfig{
+			Level: strings.ToUpper("info"),
+		},
+	)
+}
+
+type Level int
+
+const (
+	levelInfo Level = iota
+	levelDebug
+)
+
+type ServerConfig struct {
+	Host                 string
+	Port                 int
+	Timeout, ReadTimeout time.Duration
+	User                 string
+	Retries              int
+	Ratio                float64
+	Level                Level
+}
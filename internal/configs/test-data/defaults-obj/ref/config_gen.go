@@ -0,0 +1,82 @@
+// Code generated by Vanya: DO NOT EDIT.
+// versions:
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/defaults-obj/config.go
+
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
+//go:build !vanya
+// +build !vanya
+
+package defaults_obj
+
+import (
+	"github.com/ivanmashin/vanya/pkg/configs"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	configs.Embedding
+
+	ServerConfig ServerConfig         `mapstructure:"server_config"`
+	LoggerConfig configs.LoggerConfig `mapstructure:"logger_config"`
+}
+
+type ServerConfig struct {
+	Host        string        `mapstructure:"host"`
+	Port        int           `mapstructure:"port"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+	User        string        `mapstructure:"user"`
+	Retries     int           `mapstructure:"retries"`
+	Ratio       float64       `mapstructure:"ratio"`
+	Level       Level         `mapstructure:"level"`
+}
+
+type Level int
+
+var defaultHost = envOr("HOST", "localhost")
+
+func envOr(key, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+const defaultPort = 8080
+
+const defaultTimeout = 5 * time.Second
+
+func NewConfig(opts ...configs.Option) (Config, error) {
+	c := NewDefaultConfig()
+
+	err := c.Init(&c, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Embedding: configs.Embedding{},
+		ServerConfig: ServerConfig{
+			Host:        defaultHost,
+			Port:        defaultPort + 1,
+			Timeout:     defaultTimeout,
+			ReadTimeout: 2 * time.Second,
+			User:        os.Getenv("USER"),
+			Retries:     (3 * 2) + 1,
+			Ratio:       0.75,
+			Level:       Level(1),
+		},
+		LoggerConfig: configs.LoggerConfig{
+			Level: strings.ToUpper("info"),
+		},
+	}
+}
@@ -0,0 +1,18 @@
+//go:build vanya
+// +build vanya
+
+package imported_obj
+
+import (
+	"github.com/ivanmashin/vanya"
+	"github.com/ivanmashin/vanya/pkg/configs"
+)
+
+func main() {
+	vanya.BuildConfigs(
+		configs.PostgresConfig{
+			Host: "localhost",
+			Port: "5432",
+		},
+	)
+}
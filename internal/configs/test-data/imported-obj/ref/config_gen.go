@@ -0,0 +1,39 @@
+// Code generated by Vanya: DO NOT EDIT.
+// versions:
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/imported-obj/config.go
+
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
+//go:build !vanya
+// +build !vanya
+
+package imported_obj
+
+import "github.com/ivanmashin/vanya/pkg/configs"
+
+type Config struct {
+	configs.Embedding
+
+	PostgresConfig configs.PostgresConfig `mapstructure:"postgres_config"`
+}
+
+func NewConfig(opts ...configs.Option) (Config, error) {
+	c := NewDefaultConfig()
+
+	err := c.Init(&c, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Embedding: configs.Embedding{},
+		PostgresConfig: configs.PostgresConfig{
+			Host: "localhost",
+			Port: "5432",
+		},
+	}
+}
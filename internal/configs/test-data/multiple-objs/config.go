@@ -37,7 +37,7 @@ func main() {
 type OIDCConfig struct {
 	PartnerName      string
 	ClientID         string
-	ClientSecret     string
+	ClientSecret     string `secret:"true"`
 	RedirectEndpoint string
 }
 
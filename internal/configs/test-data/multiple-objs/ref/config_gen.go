@@ -1,9 +1,9 @@
 // Code generated by Vanya: DO NOT EDIT.
 // versions:
-// 	vanya v0.0.0
-// source: github.com/ivanmashin/my-service/configs/config.go
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/multiple-objs/config.go
 
-//go:generate go run github.com/ivanmashin/vanya/cmd/config
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
 //go:build !vanya
 // +build !vanya
 
@@ -14,38 +14,18 @@ import "github.com/ivanmashin/vanya/pkg/configs"
 type Config struct {
 	configs.Embedding
 
-	HttpServerConfig struct {
-		Host string `mapstructure:"host"`
-		Port string `mapstructure:"port"`
-	} `mapstructure:"http_server_config"`
-
-	GrpcServerConfig struct {
-		Host string `mapstructure:"host"`
-		Port string `mapstructure:"port"`
-	} `mapstructure:"grpc_server_config"`
-
-	PostgresConfig struct {
-		Host     string `mapstructure:"host"`
-		Port     string `mapstructure:"port"`
-		User     string `mapstructure:"user"`
-		Password string `mapstructure:"password"`
-		Database string `mapstructure:"database"`
-	} `mapstructure:"postgres_config"`
-
-	RedisConfig struct {
-		Host     string `mapstructure:"host"`
-		Port     string `mapstructure:"port"`
-		User     string `mapstructure:"user"`
-		Password string `mapstructure:"password"`
-		DB       int    `mapstructure:"db"`
-	} `mapstructure:"redis_config"`
+	HttpServerConfig configs.HttpServerConfig `mapstructure:"http_server_config"`
+	GrpcServerConfig configs.GrpcServerConfig `mapstructure:"grpc_server_config"`
+	PostgresConfig   configs.PostgresConfig   `mapstructure:"postgres_config"`
+	RedisConfig      configs.RedisConfig      `mapstructure:"redis_config"`
+	OIDCConfig       OIDCConfig               `mapstructure:"oidc_config"`
+}
 
-	OIDCConfig struct {
-		PartnerName      string `mapstructure:"partner_name"`
-		ClientID         string `mapstructure:"client_id"`
-		ClientSecret     string `mapstructure:"client_secret"`
-		RedirectEndpoint string `mapstructure:"redirect_endpoint"`
-	} `mapstructure:"oidc_config"`
+type OIDCConfig struct {
+	PartnerName      string `mapstructure:"partner_name"`
+	ClientID         string `mapstructure:"client_id"`
+	ClientSecret     string `secret:"true" mapstructure:"client_secret"`
+	RedirectEndpoint string `mapstructure:"redirect_endpoint"`
 }
 
 func NewConfig(opts ...configs.Option) (Config, error) {
@@ -62,49 +42,26 @@ func NewConfig(opts ...configs.Option) (Config, error) {
 func NewDefaultConfig() Config {
 	return Config{
 		Embedding: configs.Embedding{},
-		HttpServerConfig: struct {
-			Host string `mapstructure:"host"`
-			Port string `mapstructure:"port"`
-		}{
+		HttpServerConfig: configs.HttpServerConfig{
 			Host: "localhost",
 			Port: "8080",
 		},
-		GrpcServerConfig: struct {
-			Host string `mapstructure:"host"`
-			Port string `mapstructure:"port"`
-		}{
+		GrpcServerConfig: configs.GrpcServerConfig{
 			Host: "localhost",
 			Port: "1000",
 		},
-		PostgresConfig: struct {
-			Host     string `mapstructure:"host"`
-			Port     string `mapstructure:"port"`
-			User     string `mapstructure:"user"`
-			Password string `mapstructure:"password"`
-			Database string `mapstructure:"database"`
-		}{
+		PostgresConfig: configs.PostgresConfig{
 			Host:     "localhost",
 			Port:     "5432",
 			User:     "admin",
 			Password: "admin",
 			Database: "",
 		},
-		RedisConfig: struct {
-			Host     string `mapstructure:"host"`
-			Port     string `mapstructure:"port"`
-			User     string `mapstructure:"user"`
-			Password string `mapstructure:"password"`
-			DB       int    `mapstructure:"db"`
-		}{
+		RedisConfig: configs.RedisConfig{
 			Host: "localhost",
 			Port: "6379",
 			DB:   1,
 		},
-		OIDCConfig: struct {
-			PartnerName      string `mapstructure:"partner_name"`
-			ClientID         string `mapstructure:"client_id"`
-			ClientSecret     string `mapstructure:"client_secret"`
-			RedirectEndpoint string `mapstructure:"redirect_endpoint"`
-		}{},
+		OIDCConfig: OIDCConfig{},
 	}
 }
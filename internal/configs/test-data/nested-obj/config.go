@@ -0,0 +1,59 @@
+//go:build vanya
+// +build vanya
+
+package nested_obj
+
+import (
+	"time"
+
+	"github.com/ivanmashin/vanya"
+	"github.com/ivanmashin/vanya/pkg/configs"
+)
+
+func main() {
+	vanya.BuildConfigs(
+		ServerConfig{
+			Host: "localhost",
+			TLS: struct {
+				Enabled  bool
+				CertFile string
+			}{
+				Enabled: true,
+			},
+			AllowedOrigins: []string{"localhost"},
+			Labels:         map[string]string{"team": "core"},
+			Limits:         &Limits{RPS: 100},
+		},
+		configs.LoggerConfig{
+			Level: "info",
+		},
+	)
+}
+
+type ServerConfig struct {
+	Base
+
+	Host string
+	TLS  struct {
+		Enabled  bool
+		CertFile string
+	}
+	AllowedOrigins []string
+	Labels         map[string]string
+	Limits         *Limits
+	Backends       []Backend
+	Timeout        *time.Duration
+}
+
+type Base struct {
+	Name, Version string
+}
+
+type Limits struct {
+	RPS, Burst int
+}
+
+type Backend struct {
+	Address string
+	Weight  int
+}
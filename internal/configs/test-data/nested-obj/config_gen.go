@@ -0,0 +1,84 @@
+// Code generated by Vanya: DO NOT EDIT.
+// versions:
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/nested-obj/config.go
+
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
+//go:build !vanya
+// +build !vanya
+
+package nested_obj
+
+import (
+	"github.com/ivanmashin/vanya/pkg/configs"
+	"time"
+)
+
+type Config struct {
+	configs.Embedding
+
+	ServerConfig ServerConfig         `mapstructure:"server_config"`
+	LoggerConfig configs.LoggerConfig `mapstructure:"logger_config"`
+}
+
+type ServerConfig struct {
+	Base `mapstructure:",squash"`
+
+	Host string `mapstructure:"host"`
+	TLS  struct {
+		Enabled  bool   `mapstructure:"enabled"`
+		CertFile string `mapstructure:"cert_file"`
+	} `mapstructure:"tls"`
+	AllowedOrigins []string          `mapstructure:"allowed_origins"`
+	Labels         map[string]string `mapstructure:"labels"`
+	Limits         *Limits           `mapstructure:"limits"`
+	Backends       []Backend         `mapstructure:"backends"`
+	Timeout        *time.Duration    `mapstructure:"timeout"`
+}
+
+type Base struct {
+	Name    string `mapstructure:"name"`
+	Version string `mapstructure:"version"`
+}
+
+type Limits struct {
+	RPS   int `mapstructure:"rps"`
+	Burst int `mapstructure:"burst"`
+}
+
+type Backend struct {
+	Address string `mapstructure:"address"`
+	Weight  int    `mapstructure:"weight"`
+}
+
+func NewConfig(opts ...configs.Option) (Config, error) {
+	c := NewDefaultConfig()
+
+	err := c.Init(&c, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Embedding: configs.Embedding{},
+		ServerConfig: ServerConfig{
+			Host: "localhost",
+			TLS: struct {
+				Enabled  bool   `mapstructure:"enabled"`
+				CertFile string `mapstructure:"cert_file"`
+			}{
+				Enabled: true,
+			},
+			AllowedOrigins: []string{"localhost"},
+			Labels:         map[string]string{"team": "core"},
+			Limits:         &Limits{RPS: 100},
+		},
+		LoggerConfig: configs.LoggerConfig{
+			Level: "info",
+		},
+	}
+}
@@ -0,0 +1,40 @@
+//go:build vanya
+// +build vanya
+
+package resolved_objs
+
+import (
+	. "github.com/ivanmashin/vanya"
+	cfg "github.com/ivanmashin/vanya/pkg/configs"
+)
+
+var logger = LoggerConfig{
+	Level: "debug",
+}
+
+func main() {
+	redis := cfg.RedisConfig{
+		Host: "localhost",
+		Port: "6379",
+	}
+
+	BuildConfigs(
+		&redis,
+		logger,
+		Pair[Endpoint]{
+			First:  Endpoint{Host: "localhost", Port: 8080},
+			Second: Endpoint{Host: "localhost", Port: 8081},
+		},
+	)
+}
+
+type LoggerConfig = cfg.LoggerConfig
+
+type Pair[T any] struct {
+	First, Second T
+}
+
+type Endpoint struct {
+	Host string
+	Port int
+}
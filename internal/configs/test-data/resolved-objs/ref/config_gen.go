@@ -0,0 +1,58 @@
+// Code generated by Vanya: DO NOT EDIT.
+// versions:
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/resolved-objs/config.go
+
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
+//go:build !vanya
+// +build !vanya
+
+package resolved_objs
+
+import "github.com/ivanmashin/vanya/pkg/configs"
+
+type Config struct {
+	configs.Embedding
+
+	RedisConfig  configs.RedisConfig  `mapstructure:"redis_config"`
+	LoggerConfig configs.LoggerConfig `mapstructure:"logger_config"`
+	Pair         Pair[Endpoint]       `mapstructure:"pair"`
+}
+
+type Pair[T any] struct {
+	First  T `mapstructure:"first"`
+	Second T `mapstructure:"second"`
+}
+
+type Endpoint struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+}
+
+func NewConfig(opts ...configs.Option) (Config, error) {
+	c := NewDefaultConfig()
+
+	err := c.Init(&c, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Embedding: configs.Embedding{},
+		RedisConfig: configs.RedisConfig{
+			Host: "localhost",
+			Port: "6379",
+		},
+		LoggerConfig: configs.LoggerConfig{
+			Level: "debug",
+		},
+		Pair: Pair[Endpoint]{
+			First:  Endpoint{Host: "localhost", Port: 8080},
+			Second: Endpoint{Host: "localhost", Port: 8081},
+		},
+	}
+}
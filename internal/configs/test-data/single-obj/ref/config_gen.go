@@ -1,9 +1,9 @@
 // Code generated by Vanya: DO NOT EDIT.
 // versions:
-// 	vanya v0.0.0
-// source: github.com/ivanmashin/my-service/configs/config.go
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/single-obj/config.go
 
-//go:generate go run github.com/ivanmashin/vanya/cmd/config
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
 //go:build !vanya
 // +build !vanya
 
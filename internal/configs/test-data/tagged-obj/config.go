@@ -0,0 +1,35 @@
+//go:build vanya
+// +build vanya
+
+package tagged_obj
+
+import (
+	"github.com/ivanmashin/vanya"
+	"github.com/ivanmashin/vanya/pkg/configs"
+)
+
+func main() {
+	vanya.BuildConfigs(
+		ServerConfig{
+			Host: "localhost",
+			Port: 8080,
+		},
+		configs.LoggerConfig{
+			Level: "info",
+		},
+	)
+}
+
+// ServerConfig configures public HTTP server.
+type ServerConfig struct {
+	// Host is the interface server listens on.
+	Host string `json:"host" yaml:"host" validate:"required"`
+	Port int    `json:"port" env:"PORT" default:"8080"` // Port is the listening port.
+	// AdminToken authorizes administrative endpoints.
+	AdminToken string `mapstructure:"token" json:"-"`
+	// TLS enables HTTPS.
+	TLS struct {
+		// CertFile is the path to PEM encoded certificate.
+		CertFile, KeyFile string `yaml:"file"`
+	} `yaml:"tls"`
+}
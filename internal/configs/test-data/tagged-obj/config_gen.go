@@ -0,0 +1,58 @@
+// Code generated by Vanya: DO NOT EDIT.
+// versions:
+// 	vanya (devel)
+// source: github.com/ivanmashin/vanya/internal/configs/test-data/tagged-obj/config.go
+
+//go:generate go run github.com/ivanmashin/vanya/cmd/configs
+//go:build !vanya
+// +build !vanya
+
+package tagged_obj
+
+import "github.com/ivanmashin/vanya/pkg/configs"
+
+type Config struct {
+	configs.Embedding
+
+	ServerConfig ServerConfig         `mapstructure:"server_config"`
+	LoggerConfig configs.LoggerConfig `mapstructure:"logger_config"`
+}
+
+// ServerConfig configures public HTTP server.
+type ServerConfig struct {
+	// Host is the interface server listens on.
+	Host string `json:"host" yaml:"host" validate:"required" mapstructure:"host" usage:"Host is the interface server listens on."`
+	Port int    `json:"port" env:"PORT" default:"8080" mapstructure:"port" usage:"Port is the listening port."` // Port is the listening port.
+	// AdminToken authorizes administrative endpoints.
+	AdminToken string `mapstructure:"token" json:"-" usage:"AdminToken authorizes administrative endpoints."`
+	// TLS enables HTTPS.
+	TLS struct {
+		// CertFile is the path to PEM encoded certificate.
+		CertFile string `yaml:"file" mapstructure:"cert_file" usage:"CertFile is the path to PEM encoded certificate."`
+		KeyFile  string `yaml:"file" mapstructure:"key_file"`
+	} `yaml:"tls" mapstructure:"tls" usage:"TLS enables HTTPS."`
+}
+
+func NewConfig(opts ...configs.Option) (Config, error) {
+	c := NewDefaultConfig()
+
+	err := c.Init(&c, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+func NewDefaultConfig() Config {
+	return Config{
+		Embedding: configs.Embedding{},
+		ServerConfig: ServerConfig{
+			Host: "localhost",
+			Port: 8080,
+		},
+		LoggerConfig: configs.LoggerConfig{
+			Level: "info",
+		},
+	}
+}
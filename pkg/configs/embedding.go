@@ -1,13 +1,11 @@
 package configs
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 	"io"
 	"reflect"
 	"strings"
@@ -16,15 +14,39 @@ import (
 type Format string
 
 const (
-	FormatJSON Format = "json"
-	FormatYaml Format = "yaml"
-	FormatEnv  Format = "env"
+	FormatJSON       Format = "json"
+	FormatYaml       Format = "yaml"
+	FormatToml       Format = "toml"
+	FormatProperties Format = "properties"
+	FormatHcl        Format = "hcl"
+	// FormatEnv prints environment variables as is, e.g. to be evaluated by shell.
+	FormatEnv Format = "env"
+	// FormatDotenv prints environment variables quoted to be loaded from .env file.
+	FormatDotenv Format = "dotenv"
+	// FormatSources prints every key with its value annotated with the source it came from, see Embedding.Sources.
+	FormatSources Format = "sources"
 )
 
 type Embedding struct {
-	envPrefix   string
-	filePath    string
-	configValue any
+	envPrefix     string
+	filePaths     []string
+	profile       string
+	layers        []configLayer
+	fileSources   map[string]Source
+	secretsDir    string
+	secretSources map[string]Source
+	secrets       *secretResolver
+	decodeHooks   []mapstructure.DecodeHookFunc
+	flagSet       *pflag.FlagSet
+	args          []string
+	viper         *viper.Viper
+	watch         bool
+	onReloadError func(error)
+	strict        bool
+	onWarning     func(error)
+	reloader      *reloader
+	provenance    *provenance
+	configValue   any
 }
 
 func (e *Embedding) Init(configPtr any, opts ...Option) error {
@@ -36,40 +58,166 @@ func (e *Embedding) Init(configPtr any, opts ...Option) error {
 		panic("expected pointer to config obj")
 	}
 
+	e.layers = e.configLayers()
+
+	if e.watch {
+		if len(e.layers) == 0 {
+			return errors.New("watching requires config file, use WithConfigFile option")
+		}
+
+		e.reloader = newReloader(reflect.TypeOf(configPtr).Elem(), e.onReloadError)
+	}
+
+	if e.viper == nil {
+		e.viper = viper.New()
+	}
+
+	e.provenance = &provenance{}
+
+	if e.secrets == nil {
+		e.secrets = newSecretResolver()
+	}
+
+	if e.flagSet == nil {
+		e.flagSet = pflag.NewFlagSet("", pflag.ContinueOnError)
+	}
+
 	if e.envPrefix != "" {
-		viper.SetEnvPrefix(e.envPrefix)
+		e.viper.SetEnvPrefix(e.envPrefix)
 	}
 
-	viper.AutomaticEnv()
-	err := viper.BindPFlags(pflag.CommandLine)
+	e.viper.SetEnvKeyReplacer(strings.NewReplacer(keyDelimiter, "_"))
+	e.viper.AutomaticEnv()
+
+	err := e.bindEnv(reflect.TypeOf(configPtr))
 	if err != nil {
 		return err
 	}
 
-	if e.filePath != "" {
-		viper.SetConfigFile(e.filePath)
+	if e.strict {
+		e.checkEnv(reflect.TypeOf(configPtr))
+	}
+
+	registerFlags(e.flagSet, configPtr)
 
-		err = viper.ReadInConfig()
+	if e.args != nil && !e.flagSet.Parsed() {
+		err = e.flagSet.Parse(e.args)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = viper.Unmarshal(&configPtr)
+	state, err := e.loadConfig(reflect.TypeOf(configPtr))
+	if err != nil {
+		return err
+	}
+
+	err = e.applyConfig(state)
+	if err != nil {
+		return err
+	}
+
+	if e.reloader != nil {
+		e.reloader.state = state
+		// Embedding is a part of config, so defaults are copied after it is set up
+		e.reloader.defaults = copyConfig(configPtr)
+	}
+
+	err = e.decode(configPtr)
 	if err != nil {
 		return err
 	}
 
 	e.configValue = configPtr
 
+	if e.reloader != nil {
+		e.reloader.current.Store(configPtr)
+
+		err = e.reloader.watch(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decode unmarshals loaded settings into config resolving references to secrets, validates it and records sources of
+// the values.
+func (e *Embedding) decode(configPtr any) error {
+	if e.strict {
+		err := e.checkFileKeys(reflect.TypeOf(configPtr))
+		if err != nil {
+			return err
+		}
+	}
+
+	err := e.bindFlags(reflect.TypeOf(configPtr))
+	if err != nil {
+		return err
+	}
+
+	err = e.resolveSecrets(reflect.TypeOf(configPtr))
+	if err != nil {
+		return err
+	}
+
+	err = e.viper.Unmarshal(configPtr, viper.DecodeHook(e.decodeHook()))
+	if err != nil {
+		return err
+	}
+
+	err = validate(configPtr)
+	if err != nil {
+		return err
+	}
+
+	sources := e.resolveSources(reflect.TypeOf(configPtr))
+	e.provenance.set(sources, e.secretKeys(reflect.TypeOf(configPtr), sources))
+
+	return nil
+}
+
+// bindEnv binds every leaf key of the config to its environment variable, so nested keys absent in other sources are
+// still read from the environment. Names match the ones printed by Echo in FormatEnv.
+func (e *Embedding) bindEnv(configType reflect.Type) error {
+	for _, f := range leafFields(configType) {
+		err := e.viper.BindEnv(f.key(), envVarName(e.envPrefix, f.path))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 type Option func(*Embedding)
 
+// WithConfigFile sets config file. References in string values of YAML, JSON and TOML files are expanded before
+// decoding: ${VAR} is replaced with environment variable, ${VAR:-default} falls back to default if it is unset or empty
+// and ${VAR:?message} fails with the message instead. Names containing dot refer to other keys of the config files,
+// e.g. ${postgres_config.host}. Use $${VAR} to keep ${VAR} as is.
 func WithConfigFile(filePath string) Option {
 	return func(p *Embedding) {
-		p.filePath = filePath
+		p.filePaths = []string{filePath}
+	}
+}
+
+// WithConfigFiles sets config files deep-merged in order, so keys of overlays override the same keys of the base file
+// and the previous overlays, while other keys are kept. Every file is required. Environment variables and flags take
+// precedence over all files.
+func WithConfigFiles(base string, overlays ...string) Option {
+	return func(p *Embedding) {
+		p.filePaths = append([]string{base}, overlays...)
+	}
+}
+
+// WithProfile merges profile file named after the base config file, e.g. config.staging.yaml for config.yaml, right
+// after the base file. Profile file is required. Optional local overrides, e.g. config.local.yaml, are merged after
+// all the other files.
+func WithProfile(profile string) Option {
+	return func(p *Embedding) {
+		p.profile = profile
 	}
 }
 
@@ -79,107 +227,183 @@ func WithEnvPrefix(envPrefix string) Option {
 	}
 }
 
-// Echo prints current config to io.Writer in defined format.
-func (e *Embedding) Echo(w io.Writer, format Format) error {
-	m := make(map[string]any)
-	err := mapstructure.Decode(e, &m)
-	if err != nil {
-		return err
+// WithSecretsDir reads keys from files of the directory, e.g. /run/secrets, named after the keys or their environment
+// variables, so postgres_config.password is read from postgres_config_password or POSTGRES_CONFIG_PASSWORD file.
+// Trailing line breaks are trimmed. Secret files take precedence over config files, while environment variables and
+// flags take precedence over them. Besides, a key is read from file set by environment variable with _FILE suffix, e.g.
+// POSTGRES_CONFIG_PASSWORD_FILE=/run/secrets/pg, which does not require the option.
+func WithSecretsDir(dir string) Option {
+	return func(p *Embedding) {
+		p.secretsDir = dir
 	}
+}
 
-	switch format {
-	case FormatJSON:
-		return e.echoJson(m, w)
-	case FormatYaml:
-		return e.echoYaml(m, w)
-	case FormatEnv:
-		return e.echoEnv(m, w)
-	default:
-		return errors.New("unknown format")
+// WithWatch enables reloading config when any of the config files changes. Reloaded config is available
+// through Current, and subscribers registered with OnChange or Subscribe are notified about changed keys. If files
+// could not be decoded or validated, onError is called and the previous config is kept. By default, errors are logged.
+func WithWatch(onError func(error)) Option {
+	return func(p *Embedding) {
+		p.watch = true
+		p.onReloadError = onError
 	}
 }
 
-func (e *Embedding) echoJson(m map[string]any, w io.Writer) error {
-	encoder := json.NewEncoder(w)
+// WithStrict rejects keys of the config file matching no config field with UnknownKeyError. Environment variables
+// with the prefix set by WithEnvPrefix matching no field are reported to onWarning, by default they are logged.
+func WithStrict(onWarning func(error)) Option {
+	return func(p *Embedding) {
+		if onWarning == nil {
+			onWarning = defaultWarningHandler
+		}
 
-	encoder.SetIndent("", "\t")
-	err := encoder.Encode(m)
-	if err != nil {
-		return err
+		p.strict = true
+		p.onWarning = onWarning
 	}
+}
 
-	return nil
+// WithFlagSet sets flags bound to config keys. By default, each Embedding defines flags in its own set parsed only
+// from WithArgs. Init defines a flag for every config key missing in the set, e.g. --postgres_config.host, and binds
+// the flags set on the command line, including the ones defined by the application for config keys. To show the flags
+// in help of the application, pass pflag.CommandLine along with WithArgs(os.Args[1:]) instead of calling pflag.Parse,
+// so the set is parsed after the flags are defined. Configs sharing the set must not be initialized concurrently.
+func WithFlagSet(flagSet *pflag.FlagSet) Option {
+	return func(p *Embedding) {
+		p.flagSet = flagSet
+	}
 }
 
-func (e *Embedding) echoYaml(m map[string]any, w io.Writer) error {
-	encoder := yaml.NewEncoder(w)
+// WithArgs sets command line arguments, usually os.Args[1:], parsed by Init after flags for config keys are defined.
+// Arguments are not parsed if the flag set is already parsed.
+func WithArgs(args []string) Option {
+	return func(p *Embedding) {
+		p.args = args
+	}
+}
 
-	encoder.SetIndent(2)
-	err := encoder.Encode(m)
-	if err != nil {
-		return err
+// WithViper sets viper instance used for loading config. By default, each Embedding creates its own instance, so
+// configs initialized in the same process do not share state.
+func WithViper(v *viper.Viper) Option {
+	return func(p *Embedding) {
+		p.viper = v
 	}
+}
 
-	return nil
+// Viper returns viper instance the config was loaded with, or nil if Init was not called. If watching is enabled with
+// WithWatch, the instance is updated on reload, so it is not safe to use it concurrently.
+func (e *Embedding) Viper() *viper.Viper {
+	return e.viper
+}
+
+type echoOptions struct {
+	revealSecrets bool
 }
 
-func (e *Embedding) echoEnv(m map[string]any, w io.Writer) error {
-	queue := make([][]string, 0)
+type EchoOption func(*echoOptions)
 
-	for key := range m {
-		queue = append(queue, []string{key})
+// WithRevealedSecrets prints values of secret fields instead of masking them.
+func WithRevealedSecrets() EchoOption {
+	return func(o *echoOptions) {
+		o.revealSecrets = true
 	}
+}
 
-	for len(queue) != 0 {
-		var (
-			path  []string
-			value any
-		)
+// Echo prints current config to io.Writer in defined format using the same keys the config is loaded with. Keys are
+// sorted, so output is stable. Values of Secret fields, fields tagged with `secret:"true"`, keys read from secret
+// files and keys referring to secrets of providers are masked unless WithRevealedSecrets is passed.
+func (e *Embedding) Echo(w io.Writer, format Format, opts ...EchoOption) error {
+	o := &echoOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
-		path, queue = queue[0], queue[1:]
+	configPtr := e.Current()
+	if configPtr == nil {
+		return errors.New("config is not initialized, call Init first")
+	}
 
-		value = m
-		for _, key := range path {
-			value = value.(map[string]any)[key]
+	m := configMap(configPtr)
+	redact(m, reflect.TypeOf(configPtr), e.loadedSecretKeys(), o.revealSecrets)
+
+	switch format {
+	case FormatEnv:
+		return e.echoEnv(m, w, false)
+	case FormatDotenv:
+		return e.echoEnv(m, w, true)
+	case FormatSources:
+		return e.echoSources(m, w)
+	}
+
+	encoder, ok := lookupEncoder(format)
+	if !ok {
+		return fmt.Errorf("unknown format %s", format)
+	}
+
+	return encoder(w, m)
+}
+
+// echoEnv prints environment variables the config is loaded from. If quote is set, values are quoted as in .env files.
+func (e *Embedding) echoEnv(m map[string]any, w io.Writer, quote bool) error {
+	for _, v := range flatten(m) {
+		value := formatValue(v.value)
+		if quote {
+			value = quoteDotenv(value)
 		}
 
-		switch value.(type) {
-		case map[string]any:
-			for k := range value.(map[string]any) {
-				newPath := make([]string, len(path))
-				copy(newPath, path)
+		_, err := fmt.Fprintf(w, "%s=%s\n", envVarName(e.envPrefix, v.path), value)
+		if err != nil {
+			return err
+		}
+	}
 
-				newPath = append(newPath, k)
-				queue = append(queue, newPath)
-			}
-		default:
-			if e.envPrefix != "" {
-				_, err := io.WriteString(w, e.envPrefix)
-				if err != nil {
-					return err
-				}
-			}
+	return nil
+}
 
-			for i, key := range path {
-				_, err := io.WriteString(w, strings.ToUpper(key))
-				if err != nil {
-					return err
-				}
-
-				if i != len(path)-1 {
-					_, err = io.WriteString(w, "_")
-					if err != nil {
-						return err
-					}
-				}
-			}
+// configMap returns values of the config leaf fields nested by their keys. Nil pointers are omitted.
+func configMap(configPtr any) map[string]any {
+	m := make(map[string]any)
+	config := reflect.ValueOf(configPtr)
+
+	for _, f := range leafFields(config.Type()) {
+		value := fieldValue(config, f.index)
+		for value.IsValid() && value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
 
-			_, err := io.WriteString(w, fmt.Sprintf("=%v\n", value))
-			if err != nil {
-				return err
+		if !value.IsValid() {
+			continue
+		}
+
+		parent := m
+		for _, key := range f.path[:len(f.path)-1] {
+			child, ok := parent[key].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				parent[key] = child
 			}
+
+			parent = child
+		}
+
+		if stringStructTypes[value.Type()] {
+			value = reflect.ValueOf(formatStringStruct(value))
 		}
+
+		parent[f.path[len(f.path)-1]] = value.Interface()
 	}
 
-	return nil
+	return m
+}
+
+// walkMap calls fn for every value of m which is not a nested map.
+func walkMap(m map[string]any, path []string, fn func(path []string, value any)) {
+	for key, value := range m {
+		valuePath := append(append(make([]string, 0, len(path)+1), path...), key)
+
+		nested, ok := value.(map[string]any)
+		if ok {
+			walkMap(nested, valuePath, fn)
+		} else {
+			fn(valuePath, value)
+		}
+	}
 }
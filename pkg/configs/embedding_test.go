@@ -0,0 +1,1229 @@
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Embedding
+
+	PostgresConfig PostgresConfig `mapstructure:"postgres_config"`
+	RedisConfig    RedisConfig    `mapstructure:"redis_config"`
+	OIDCConfig     oidcConfig     `mapstructure:"oidc_config"`
+}
+
+type oidcConfig struct {
+	ClientID     string
+	ClientSecret Secret
+}
+
+func (c *testConfig) Validate() error {
+	if c.RedisConfig.DB < 0 {
+		return errors.New("negative redis db")
+	}
+
+	return nil
+}
+
+func newTestConfig() testConfig {
+	return testConfig{
+		PostgresConfig: PostgresConfig{
+			Host: "localhost",
+			Port: "5432",
+		},
+		RedisConfig: RedisConfig{
+			Host: "localhost",
+			Port: "6379",
+			DB:   1,
+		},
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	filePath := path.Join(t.TempDir(), name)
+
+	err := os.WriteFile(filePath, []byte(content), 0600)
+	assert.NoError(t, err)
+
+	return filePath
+}
+
+// replaceFile writes the file atomically, so watcher does not observe it truncated.
+func replaceFile(t *testing.T, filePath, content string) {
+	tmpPath := filePath + ".tmp"
+
+	err := os.WriteFile(tmpPath, []byte(content), 0600)
+	assert.NoError(t, err)
+
+	err = os.Rename(tmpPath, filePath)
+	assert.NoError(t, err)
+}
+
+func TestEmbedding_Isolated(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		host := fmt.Sprintf("postgres-%d", i)
+
+		t.Run(
+			host, func(t *testing.T) {
+				t.Parallel()
+
+				filePath := writeFile(t, "config.yaml", "postgres_config:\n  host: "+host+"\n")
+
+				c := newTestConfig()
+				c.RedisConfig.Host = host
+
+				// configs without flag set do not share flags
+				err := c.Init(&c, WithConfigFile(filePath))
+				assert.NoError(t, err)
+
+				assert.Equal(t, host, c.PostgresConfig.Host)
+				assert.Equal(t, "5432", c.PostgresConfig.Port)
+				assert.Equal(t, host, c.RedisConfig.Host)
+				assert.Equal(t, host, c.Viper().GetString("postgres_config.host"))
+			},
+		)
+	}
+}
+
+func TestEmbedding_EnvRoundTrip(t *testing.T) {
+	t.Setenv("APP_POSTGRES_CONFIG_HOST", "postgres")
+	t.Setenv("APP_REDIS_CONFIG_DB", "2")
+
+	c := newTestConfig()
+	err := c.Init(&c, WithEnvPrefix("app"), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "postgres", c.PostgresConfig.Host)
+	assert.Equal(t, 2, c.RedisConfig.DB)
+
+	c.PostgresConfig.Password = "secret"
+	c.RedisConfig.Port = "6380"
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatEnv, WithRevealedSecrets())
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "APP_POSTGRES_CONFIG_PASSWORD=secret\n")
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		t.Setenv(key, value)
+	}
+
+	loaded := testConfig{}
+	err = loaded.Init(&loaded, WithEnvPrefix("app"), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, c.PostgresConfig, loaded.PostgresConfig)
+	assert.Equal(t, c.RedisConfig, loaded.RedisConfig)
+
+	collections := labelsConfig{Labels: map[string]string{"team": "core", "x": "y=z"}, Tags: []string{"a", "b"}}
+	err = collections.Init(&collections, WithEnvPrefix("col"))
+	assert.NoError(t, err)
+
+	buf.Reset()
+	err = collections.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "COL_LABELS=team=core,x=y=z\nCOL_TAGS=a,b\n", buf.String())
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		t.Setenv(key, value)
+	}
+
+	loadedCollections := labelsConfig{}
+	err = loadedCollections.Init(&loadedCollections, WithEnvPrefix("col"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, collections.Labels, loadedCollections.Labels)
+	assert.Equal(t, collections.Tags, loadedCollections.Tags)
+}
+
+func TestEmbedding_Watch(t *testing.T) {
+	filePath := writeFile(t, "config.yaml", "redis_config:\n  host: redis\n")
+	reloadErrs := make(chan error, 1)
+
+	c := newTestConfig()
+	err := c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithWatch(
+			func(err error) {
+				reloadErrs <- err
+			},
+		),
+	)
+	assert.NoError(t, err)
+
+	defer c.Close()
+
+	err = Subscribe(&c.Embedding, "redis_config.db", func(old, new string) {})
+	assert.Error(t, err)
+
+	err = Subscribe(&c.Embedding, "postgres_config.hostname", func(old, new string) {})
+	assert.Error(t, err)
+
+	redisChanges := make(chan [2]RedisConfig, 1)
+	err = Subscribe(
+		&c.Embedding, "redis_config", func(old, new RedisConfig) {
+			redisChanges <- [2]RedisConfig{old, new}
+		},
+	)
+	assert.NoError(t, err)
+
+	changes := make(chan []Change, 1)
+	err = c.OnChange(
+		func(c []Change) {
+			changes <- c
+		},
+	)
+	assert.NoError(t, err)
+
+	replaceFile(t, filePath, "redis_config:\n  host: redis\n  db: 3\n")
+
+	select {
+	case redis := <-redisChanges:
+		assert.Equal(t, 1, redis[0].DB)
+		assert.Equal(t, 3, redis[1].DB)
+		assert.Equal(t, "redis", redis[1].Host)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	assert.Equal(t, []Change{{Key: "redis_config.db", Old: 1, New: 3}}, <-changes)
+	assert.Equal(t, 3, c.Current().(*testConfig).RedisConfig.DB)
+
+	replaceFile(t, filePath, "redis_config:\n  db: -1\n")
+
+	select {
+	case err = <-reloadErrs:
+		assert.ErrorContains(t, err, "negative redis db")
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error was not reported")
+	}
+
+	assert.Equal(t, 3, c.Current().(*testConfig).RedisConfig.DB)
+	assert.Equal(t, 3, c.Viper().GetInt("redis_config.db"))
+	assert.Equal(t, "redis", c.Viper().GetString("redis_config.host"))
+	assert.Equal(t, Source{Kind: SourceFile, Name: filePath, Line: 2}, c.Sources()["redis_config.host"])
+}
+
+func TestEmbedding_EchoDuringReload(t *testing.T) {
+	filePath := writeFile(t, "config.yaml", "redis_config:\n  db: 0\n")
+
+	c := newTestConfig()
+	err := c.Init(&c, WithConfigFile(filePath), WithWatch(nil))
+	assert.NoError(t, err)
+
+	defer c.Close()
+
+	changes := make(chan []Change, 10)
+	err = c.OnChange(
+		func(c []Change) {
+			changes <- c
+		},
+	)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 1; i <= 10; i++ {
+			replaceFile(t, filePath, fmt.Sprintf("redis_config:\n  db: %d\n", i))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			err = c.Echo(io.Discard, FormatYaml)
+			assert.NoError(t, err)
+		}
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+}
+
+type labelsConfig struct {
+	Embedding
+
+	Labels map[string]string `mapstructure:"labels"`
+	Tags   []string          `mapstructure:"tags"`
+}
+
+func TestEmbedding_WatchRemovedKeys(t *testing.T) {
+	filePath := writeFile(t, "config.yaml", "labels:\n  x: \"1\"\n")
+
+	c := labelsConfig{Labels: map[string]string{"team": "core"}}
+	err := c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithWatch(nil),
+	)
+	assert.NoError(t, err)
+
+	defer c.Close()
+
+	assert.Equal(t, map[string]string{"team": "core", "x": "1"}, c.Labels)
+
+	changes := make(chan []Change, 1)
+	err = c.OnChange(
+		func(c []Change) {
+			changes <- c
+		},
+	)
+	assert.NoError(t, err)
+
+	replaceFile(t, filePath, "labels:\n  y: \"2\"\n")
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	assert.Equal(t, map[string]string{"team": "core", "y": "2"}, c.Current().(*labelsConfig).Labels)
+	assert.Equal(t, map[string]string{"team": "core", "x": "1"}, c.Labels)
+}
+
+func TestRedact(t *testing.T) {
+	c := newTestConfig()
+	c.PostgresConfig.Password = "postgres-password"
+	c.OIDCConfig.ClientSecret = "client-secret"
+
+	assert.Equal(t, secretMask, fmt.Sprint(c.OIDCConfig.ClientSecret))
+
+	m := configMap(&c)
+	redact(m, reflect.TypeOf(&c), nil, false)
+	assert.Equal(t, secretMask, m["postgres_config"].(map[string]any)["password"])
+	assert.Equal(t, secretMask, m["oidc_config"].(map[string]any)["clientsecret"])
+	assert.Equal(t, secretMask, m["redis_config"].(map[string]any)["password"])
+	assert.Equal(t, "localhost", m["postgres_config"].(map[string]any)["host"])
+
+	m = configMap(&c)
+	redact(m, reflect.TypeOf(&c), nil, true)
+	assert.Equal(t, "postgres-password", m["postgres_config"].(map[string]any)["password"])
+	assert.Equal(t, "client-secret", m["oidc_config"].(map[string]any)["clientsecret"])
+}
+
+func TestEmbedding_Echo(t *testing.T) {
+	c := newTestConfig()
+
+	err := c.Echo(&bytes.Buffer{}, FormatJSON)
+	assert.Error(t, err)
+
+	err = c.Init(&c, WithEnvPrefix("app"), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	c.PostgresConfig.Password = "password"
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatJSON)
+	assert.NoError(t, err)
+	assert.JSONEq(
+		t, `{
+			"oidc_config": {"clientid": "", "clientsecret": "******"},
+			"postgres_config": {"database": "", "host": "localhost", "password": "******", "port": "5432", "user": ""},
+			"redis_config": {"db": 1, "host": "localhost", "password": "******", "port": "6379", "user": ""}
+		}`, buf.String(),
+	)
+
+	for _, format := range []Format{FormatJSON, FormatYaml, FormatEnv} {
+		first := &bytes.Buffer{}
+		err = c.Echo(first, format)
+		assert.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			next := &bytes.Buffer{}
+			err = c.Echo(next, format)
+			assert.NoError(t, err)
+			assert.Equal(t, first.String(), next.String(), format)
+		}
+	}
+
+	buf.Reset()
+	err = c.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Equal(
+		t, `APP_OIDC_CONFIG_CLIENTID=
+APP_OIDC_CONFIG_CLIENTSECRET=******
+APP_POSTGRES_CONFIG_DATABASE=
+APP_POSTGRES_CONFIG_HOST=localhost
+APP_POSTGRES_CONFIG_PASSWORD=******
+APP_POSTGRES_CONFIG_PORT=5432
+APP_POSTGRES_CONFIG_USER=
+APP_REDIS_CONFIG_DB=1
+APP_REDIS_CONFIG_HOST=localhost
+APP_REDIS_CONFIG_PASSWORD=******
+APP_REDIS_CONFIG_PORT=6379
+APP_REDIS_CONFIG_USER=
+`, buf.String(),
+	)
+}
+
+func TestEmbedding_Sources(t *testing.T) {
+	filePath := writeFile(t, "config.yaml", "postgres_config:\n  host: postgres\n  port: 5433\n")
+	t.Setenv("APP_POSTGRES_CONFIG_PORT", "5434")
+
+	flagSet := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flagSet.String("redis_config.host", "localhost", "")
+
+	err := flagSet.Parse([]string{"--redis_config.host=redis"})
+	assert.NoError(t, err)
+
+	c := newTestConfig()
+	err = c.Init(&c, WithEnvPrefix("app"), WithConfigFile(filePath), WithFlagSet(flagSet))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "5434", c.PostgresConfig.Port)
+	assert.Equal(t, "redis", c.RedisConfig.Host)
+
+	sources := c.Sources()
+	assert.Equal(t, Source{Kind: SourceFile, Name: filePath, Line: 2}, sources["postgres_config.host"])
+	assert.Equal(t, Source{Kind: SourceEnv, Name: "APP_POSTGRES_CONFIG_PORT"}, sources["postgres_config.port"])
+	assert.Equal(t, Source{Kind: SourceFlag, Name: "redis_config.host"}, sources["redis_config.host"])
+	assert.Equal(t, Source{Kind: SourceDefault}, sources["redis_config.db"])
+
+	source, ok := c.Source("REDIS_CONFIG.DB")
+	assert.True(t, ok)
+	assert.Equal(t, SourceDefault, source.Kind)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatSources)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "postgres_config.host=postgres # file "+filePath+":2\n")
+	assert.Contains(t, buf.String(), "postgres_config.password=****** # default\n")
+	assert.Contains(t, buf.String(), "postgres_config.port=5434 # env APP_POSTGRES_CONFIG_PORT\n")
+	assert.Contains(t, buf.String(), "redis_config.host=redis # flag --redis_config.host\n")
+}
+
+type validatedConfig struct {
+	Embedding
+
+	Endpoint string          `mapstructure:"endpoint" validate:"required,hostport"`
+	Callback string          `mapstructure:"callback" validate:"url"`
+	Level    string          `mapstructure:"level" validate:"oneof=debug info"`
+	Name     string          `mapstructure:"name" validate:"min=2,max=4,regexp=^[a-z]{1,}$"`
+	Timeout  time.Duration   `mapstructure:"timeout" validate:"max=1m"`
+	Workers  int             `mapstructure:"workers" validate:"min=1"`
+	Retries  *int            `mapstructure:"retries" validate:"min=1"`
+	Limits   validatedLimits `mapstructure:"limits"`
+}
+
+type validatedLimits struct {
+	Min int `mapstructure:"min" validate:"min=0"`
+	Max int `mapstructure:"max"`
+}
+
+func (l validatedLimits) Validate() error {
+	if l.Max < l.Min {
+		return errors.New("max is less than min")
+	}
+
+	return nil
+}
+
+func TestEmbedding_Validate(t *testing.T) {
+	filePath := writeFile(
+		t, "config.yaml", `
+callback: /relative
+level: trace
+name: Name1
+timeout: 2m
+limits:
+  min: -2
+  max: -3
+`,
+	)
+
+	c := validatedConfig{}
+	err := c.Init(&c, WithConfigFile(filePath), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+
+	keys := make([]string, len(validationErr.Errors))
+	for i, keyErr := range validationErr.Errors {
+		keys[i] = keyErr.Key
+	}
+
+	assert.Equal(
+		t, []string{"endpoint", "callback", "level", "name", "timeout", "workers", "limits", "limits.min"}, keys,
+	)
+	assert.ErrorContains(t, err, "workers: value must be at least 1")
+	assert.ErrorContains(t, err, "limits: max is less than min")
+	assert.ErrorContains(t, err, "name: length must be at most 4")
+
+	filePath = writeFile(
+		t, "config.yaml", `
+endpoint: localhost:8080
+level: info
+name: abc
+timeout: 30s
+workers: 2
+limits:
+  min: 1
+  max: 2
+`,
+	)
+
+	c = validatedConfig{}
+	err = c.Init(&c, WithConfigFile(filePath), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	p := PostgresConfig{Port: "port"}
+	err = validate(&p)
+	assert.ErrorContains(t, err, "host: value is required")
+	assert.ErrorContains(t, err, `port: value "port" is not a port number`)
+}
+
+func TestEmbedding_Flags(t *testing.T) {
+	flagSet := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flagSet.String("redis_config.db", "1", "predefined")
+
+	c := newTestConfig()
+	c.PostgresConfig.Password = "password"
+
+	err := c.Init(
+		&c,
+		WithFlagSet(flagSet),
+		WithArgs([]string{"--postgres_config.host=postgres", "--redis_config.port", "6380", "--redis_config.db=2"}),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "postgres", c.PostgresConfig.Host)
+	assert.Equal(t, "5432", c.PostgresConfig.Port)
+	assert.Equal(t, "password", c.PostgresConfig.Password)
+	assert.Equal(t, "6380", c.RedisConfig.Port)
+	assert.Equal(t, 2, c.RedisConfig.DB)
+
+	usages := flagSet.FlagUsages()
+	assert.Contains(t, usages, `--postgres_config.port string       PostgreSQL port. (default "5432")`)
+	assert.Contains(t, usages, "--postgres_config.password string   PostgreSQL password.\n")
+	assert.Contains(t, usages, "--oidc_config.clientsecret string")
+	assert.Contains(t, usages, "predefined")
+
+	source, _ := c.Source("redis_config.port")
+	assert.Equal(t, Source{Kind: SourceFlag, Name: "redis_config.port"}, source)
+}
+
+func TestEmbedding_FlagsCommandLine(t *testing.T) {
+	commandLine := pflag.CommandLine
+	defer func() {
+		pflag.CommandLine = commandLine
+	}()
+
+	pflag.CommandLine = pflag.NewFlagSet("app", pflag.ContinueOnError)
+	verbose := pflag.Bool("verbose", false, "Verbose output.")
+	pflag.String("redis_config.host", "localhost", "Redis host of the application.")
+
+	c := newTestConfig()
+	err := c.Init(
+		&c,
+		WithFlagSet(pflag.CommandLine),
+		WithArgs([]string{"--verbose", "--postgres_config.host=postgres", "--redis_config.host=redis"}),
+	)
+	assert.NoError(t, err)
+
+	assert.True(t, *verbose)
+	assert.True(t, pflag.Parsed())
+	assert.Equal(t, "postgres", c.PostgresConfig.Host)
+	assert.Equal(t, "redis", c.RedisConfig.Host)
+
+	usages := pflag.CommandLine.FlagUsages()
+	assert.Contains(t, usages, "Verbose output.")
+	assert.Contains(t, usages, "Redis host of the application.")
+	assert.Contains(t, usages, `--postgres_config.port string       PostgreSQL port. (default "5432")`)
+}
+
+type optionalConfig struct {
+	Embedding
+
+	Timeout *time.Duration `mapstructure:"timeout"`
+	Limits  *limitsConfig  `mapstructure:"limits"`
+}
+
+type limitsConfig struct {
+	Rate int `mapstructure:"rate"`
+}
+
+func TestEmbedding_FlagsKeepNilFields(t *testing.T) {
+	c := optionalConfig{}
+	err := c.Init(&c)
+	assert.NoError(t, err)
+
+	assert.Nil(t, c.Timeout)
+	assert.Nil(t, c.Limits)
+
+	c = optionalConfig{}
+	err = c.Init(&c, WithArgs([]string{"--timeout=5s", "--limits.rate=10"}))
+	assert.NoError(t, err)
+
+	if assert.NotNil(t, c.Timeout) && assert.NotNil(t, c.Limits) {
+		assert.Equal(t, 5*time.Second, *c.Timeout)
+		assert.Equal(t, 10, c.Limits.Rate)
+	}
+}
+
+func TestEmbedding_Strict(t *testing.T) {
+	filePath := writeFile(
+		t, "config.yaml", `
+postgress_config:
+  host: postgres
+redis_config:
+  host: redis
+  dbname: 1
+`,
+	)
+	t.Setenv("APP_REDIS_CONFIG_PROT", "6380")
+	t.Setenv("APP_REDIS_CONFIG_PORT", "6381")
+
+	warnings := make([]error, 0)
+	onWarning := func(err error) {
+		warnings = append(warnings, err)
+	}
+
+	c := newTestConfig()
+	err := c.Init(&c, WithConfigFile(filePath), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithEnvPrefix("app"),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithStrict(onWarning),
+	)
+
+	var unknownKeyErr *UnknownKeyError
+	assert.ErrorAs(t, err, &unknownKeyErr)
+	assert.Equal(
+		t,
+		filePath+":3: unknown key postgress_config.host, did you mean postgres_config.host?\n"+
+			filePath+":6: unknown key redis_config.dbname, did you mean redis_config.db?",
+		err.Error(),
+	)
+
+	assert.Len(t, warnings, 1)
+	assert.EqualError(
+		t, warnings[0], "unknown environment variable APP_REDIS_CONFIG_PROT, did you mean APP_REDIS_CONFIG_PORT?",
+	)
+}
+
+func TestEmbedding_Formats(t *testing.T) {
+	c := newTestConfig()
+	err := c.Init(&c, WithEnvPrefix("app"), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+
+	c.PostgresConfig.Password = `p@ss word='"$HOME\t` + "\nline"
+	c.PostgresConfig.User = "user=admin # not a comment"
+	c.OIDCConfig.ClientSecret = "it's a secret"
+
+	for format, ext := range map[Format]string{
+		FormatJSON:       "json",
+		FormatYaml:       "yaml",
+		FormatToml:       "toml",
+		FormatProperties: "properties",
+		FormatHcl:        "hcl",
+		FormatDotenv:     "env",
+	} {
+		t.Run(
+			string(format), func(t *testing.T) {
+				buf := &bytes.Buffer{}
+				err := c.Echo(buf, format, WithRevealedSecrets())
+				assert.NoError(t, err)
+
+				filePath := writeFile(t, "config."+ext, buf.String())
+
+				loaded := testConfig{}
+				err = loaded.Init(
+					&loaded,
+					WithEnvPrefix("app"),
+					WithConfigFile(filePath),
+					WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+					WithStrict(nil),
+				)
+				assert.NoError(t, err)
+
+				assert.Equal(t, c.PostgresConfig, loaded.PostgresConfig, buf.String())
+				assert.Equal(t, c.RedisConfig, loaded.RedisConfig)
+				assert.Equal(t, c.OIDCConfig, loaded.OIDCConfig)
+			},
+		)
+	}
+
+	err = c.Echo(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
+
+func TestRegisterFormat(t *testing.T) {
+	format := Format("lines")
+
+	RegisterFormat(
+		format,
+		func(w io.Writer, m map[string]any) error {
+			for _, v := range flatten(m) {
+				_, err := fmt.Fprintf(w, "%s %v\n", strings.Join(v.path, keyDelimiter), v.value)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		func(r io.Reader) (map[string]any, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+
+			m := make(map[string]any)
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				key, value, _ := strings.Cut(line, " ")
+				section, name, _ := strings.Cut(key, keyDelimiter)
+
+				if _, ok := m[section]; !ok {
+					m[section] = make(map[string]any)
+				}
+
+				m[section].(map[string]any)[name] = value
+			}
+
+			return m, nil
+		},
+		"lines",
+	)
+
+	filePath := writeFile(t, "config.lines", "redis_config.host redis\nredis_config.db 4\n")
+
+	c := newTestConfig()
+	err := c.Init(&c, WithConfigFile(filePath), WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)))
+	assert.NoError(t, err)
+	assert.Equal(t, "redis", c.RedisConfig.Host)
+	assert.Equal(t, 4, c.RedisConfig.DB)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, format)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "redis_config.db 4\nredis_config.host redis\n")
+}
+
+func TestEmbedding_Layers(t *testing.T) {
+	dir := t.TempDir()
+	basePath := path.Join(dir, "config.yaml")
+	profilePath := path.Join(dir, "config.staging.yaml")
+	localPath := path.Join(dir, "config.local.yaml")
+	overlayPath := path.Join(dir, "overlay.json")
+
+	err := os.WriteFile(basePath, []byte("postgres_config:\n  host: base\n  user: admin\nredis_config:\n  db: 2\n"), 0600)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(overlayPath, []byte(`{"postgres_config": {"database": "overlay"}}`), 0600)
+	assert.NoError(t, err)
+
+	c := newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFiles(basePath, overlayPath),
+		WithProfile("staging"),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.ErrorContains(t, err, "required config file "+profilePath+" does not exist")
+
+	err = os.WriteFile(profilePath, []byte("postgres_config:\n  host: staging\n"), 0600)
+	assert.NoError(t, err)
+
+	t.Setenv("APP_REDIS_CONFIG_DB", "5")
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithEnvPrefix("app"),
+		WithConfigFiles(basePath, overlayPath),
+		WithProfile("staging"),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "staging", c.PostgresConfig.Host)
+	assert.Equal(t, "admin", c.PostgresConfig.User)
+	assert.Equal(t, "overlay", c.PostgresConfig.Database)
+	assert.Equal(t, "5432", c.PostgresConfig.Port)
+	assert.Equal(t, 5, c.RedisConfig.DB)
+
+	sources := c.Sources()
+	assert.Equal(t, Source{Kind: SourceFile, Name: profilePath, Line: 2}, sources["postgres_config.host"])
+	assert.Equal(t, Source{Kind: SourceFile, Name: basePath, Line: 3}, sources["postgres_config.user"])
+	assert.Equal(t, Source{Kind: SourceFile, Name: overlayPath, Line: 1}, sources["postgres_config.database"])
+	assert.Equal(t, SourceEnv, sources["redis_config.db"].Kind)
+
+	err = os.WriteFile(localPath, []byte("postgres_config:\n  database: local\n"), 0600)
+	assert.NoError(t, err)
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFiles(basePath, overlayPath),
+		WithProfile("staging"),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", c.PostgresConfig.Database)
+	assert.Equal(t, "staging", c.PostgresConfig.Host)
+}
+
+type bigConfig struct {
+	Embedding
+
+	Big int64 `mapstructure:"big"`
+}
+
+func TestEmbedding_LayersKeepIntegers(t *testing.T) {
+	basePath := writeFile(t, "config.yaml", "big: 1\n")
+	overlayPath := writeFile(t, "overlay.yaml", "big: 9007199254740993\n")
+
+	c := bigConfig{}
+	err := c.Init(&c, WithConfigFiles(basePath, overlayPath))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), c.Big)
+}
+
+func TestEmbedding_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	secretsDir := path.Join(dir, "secrets")
+	passwordPath := path.Join(dir, "pg")
+
+	err := os.Mkdir(secretsDir, 0700)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(passwordPath, []byte("from-env-file\n"), 0600)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path.Join(secretsDir, "APP_OIDC_CONFIG_CLIENTID"), []byte("client\r\n"), 0600)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path.Join(secretsDir, "redis_config.password"), []byte("from-dir"), 0600)
+	assert.NoError(t, err)
+
+	t.Setenv("APP_POSTGRES_CONFIG_PASSWORD_FILE", passwordPath)
+
+	c := newTestConfig()
+	err = c.Init(
+		&c,
+		WithEnvPrefix("app"),
+		WithSecretsDir(secretsDir),
+		WithStrict(func(err error) { t.Error(err) }),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "from-env-file", c.PostgresConfig.Password)
+	assert.Equal(t, "from-dir", c.RedisConfig.Password)
+	assert.Equal(t, "client", c.OIDCConfig.ClientID)
+
+	sources := c.Sources()
+	assert.Equal(t, Source{Kind: SourceSecretFile, Name: passwordPath}, sources["postgres_config.password"])
+	assert.Equal(
+		t, Source{Kind: SourceSecretFile, Name: path.Join(secretsDir, "redis_config.password")},
+		sources["redis_config.password"],
+	)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "APP_OIDC_CONFIG_CLIENTID=******\n")
+	assert.NotContains(t, buf.String(), "from-env-file")
+	assert.NotContains(t, buf.String(), "from-dir")
+
+	t.Setenv("APP_POSTGRES_CONFIG_PASSWORD", "from-env")
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithEnvPrefix("app"),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.ErrorContains(t, err, "both APP_POSTGRES_CONFIG_PASSWORD and APP_POSTGRES_CONFIG_PASSWORD_FILE are set")
+
+	t.Setenv("APP_POSTGRES_CONFIG_PASSWORD_FILE", "")
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithEnvPrefix("app"),
+		WithSecretsDir(secretsDir),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithArgs([]string{"--redis_config.password=from-flag"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", c.PostgresConfig.Password)
+	assert.Equal(t, "from-flag", c.RedisConfig.Password)
+}
+
+func TestEmbedding_SecretFilesKeepViperOverrides(t *testing.T) {
+	secretsDir := t.TempDir()
+
+	err := os.WriteFile(path.Join(secretsDir, "postgres_config.password"), []byte("from-dir"), 0600)
+	assert.NoError(t, err)
+
+	v := viper.New()
+	v.Set("postgres_config.host", "override")
+
+	c := newTestConfig()
+	err = c.Init(
+		&c,
+		WithViper(v),
+		WithSecretsDir(secretsDir),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "override", c.PostgresConfig.Host)
+	assert.Equal(t, "from-dir", c.PostgresConfig.Password)
+
+	filePath := writeFile(t, "config.yaml", "redis_config:\n  host: redis\n")
+	changes := make(chan []Change, 1)
+
+	v = viper.New()
+	v.Set("postgres_config.host", "override")
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithViper(v),
+		WithConfigFile(filePath),
+		WithSecretsDir(secretsDir),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithWatch(func(err error) { t.Error(err) }),
+	)
+	assert.NoError(t, err)
+
+	defer c.Close()
+
+	err = c.OnChange(
+		func(c []Change) {
+			changes <- c
+		},
+	)
+	assert.NoError(t, err)
+
+	replaceFile(t, filePath, "redis_config:\n  host: redis-2\n")
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	current := c.Current().(*testConfig)
+	assert.Equal(t, "override", current.PostgresConfig.Host)
+	assert.Equal(t, "from-dir", current.PostgresConfig.Password)
+	assert.Equal(t, "redis-2", current.RedisConfig.Host)
+}
+
+func TestEmbedding_SecretProviders(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(path.Join(dir, "redis"), []byte("password: redis-pass\n"), 0600)
+	assert.NoError(t, err)
+
+	filePath := writeFile(
+		t, "config.yaml",
+		"postgres_config:\n  password: secret://vault/db#password\n  database: app-${secret:db-name}\n"+
+			"redis_config:\n  password: secret://files/redis#password\n",
+	)
+
+	vault := NewMemorySecretProvider(map[string]string{"db#password": "pg-pass", "db-name": "main"})
+	reloadErrs := make(chan error, 1)
+
+	c := newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithSecretProvider("vault", vault),
+		WithSecretProvider(DefaultSecretProvider, vault),
+		WithSecretProvider("files", &FileSecretProvider{Dir: dir}),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithWatch(
+			func(err error) {
+				reloadErrs <- err
+			},
+		),
+	)
+	assert.NoError(t, err)
+
+	defer c.Close()
+
+	assert.Equal(t, "pg-pass", c.PostgresConfig.Password)
+	assert.Equal(t, "app-main", c.PostgresConfig.Database)
+	assert.Equal(t, "redis-pass", c.RedisConfig.Password)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "POSTGRES_CONFIG_DATABASE=******\n")
+
+	changes := make(chan []Change, 1)
+	err = c.OnChange(
+		func(c []Change) {
+			changes <- c
+		},
+	)
+	assert.NoError(t, err)
+
+	// cached secrets are fetched again on reload
+	vault.Set("db#password", "rotated")
+	replaceFile(
+		t, filePath,
+		"postgres_config:\n  password: secret://vault/db#password\n  database: app-${secret:db-name}\n"+
+			"redis_config:\n  password: secret://files/redis#password\n  db: 2\n",
+	)
+
+	select {
+	case <-changes:
+		assert.Equal(t, "rotated", c.Current().(*testConfig).PostgresConfig.Password)
+	case err = <-reloadErrs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	filePath = writeFile(
+		t, "invalid.yaml",
+		"postgres_config:\n  password: secret://unknown/db\n  database: ${secret:missing}\n",
+	)
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithSecretProvider("vault", vault),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+
+	var refErr *SecretRefError
+	assert.ErrorAs(t, err, &refErr)
+	assert.ErrorContains(t, err, "postgres_config.password: resolve secret://unknown/db: unknown secret provider unknown")
+	assert.ErrorContains(t, err, "postgres_config.database: resolve secret://vault/missing: secret missing does not exist")
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	secretsDir := path.Join(dir, "secrets")
+
+	err := os.Mkdir(secretsDir, 0700)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path.Join(secretsDir, "db"), []byte("pass\n"), 0600)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path.Join(dir, "outside"), []byte("leaked"), 0600)
+	assert.NoError(t, err)
+
+	provider := &FileSecretProvider{Dir: secretsDir}
+
+	secret, err := provider.Secret(SecretRef{Provider: "files", Path: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, "pass", secret)
+
+	for _, p := range []string{"../outside", "nested/../../outside", path.Join(dir, "outside")} {
+		_, err = provider.Secret(SecretRef{Provider: "files", Path: p})
+		assert.ErrorContains(t, err, "is outside of secrets directory", p)
+	}
+}
+
+func TestEmbedding_Interpolation(t *testing.T) {
+	t.Setenv("PG_HOST", "db.internal")
+	t.Setenv("PG_USER", "")
+
+	filePath := writeFile(
+		t, "config.yaml",
+		"postgres_config:\n"+
+			"  host: ${PG_HOST}\n"+
+			"  user: ${PG_USER:-admin}\n"+
+			"  database: $${PG_HOST}\n"+
+			"  password: ${secret:pg-pass}\n"+
+			"oidc_config:\n"+
+			"  clientid: id-$${secret:pg-pass}\n"+
+			"redis_config:\n"+
+			"  host: ${postgres_config.host}\n"+
+			"  password: ${REDIS_PASSWORD:-${postgres_config.user}-pass}\n",
+	)
+
+	c := newTestConfig()
+	err := c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithSecretProvider("vault", NewMemorySecretProvider(map[string]string{"pg-pass": "secret"})),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "db.internal", c.PostgresConfig.Host)
+	assert.Equal(t, "admin", c.PostgresConfig.User)
+	assert.Equal(t, "${PG_HOST}", c.PostgresConfig.Database)
+	assert.Equal(t, "secret", c.PostgresConfig.Password)
+	assert.Equal(t, "id-${secret:pg-pass}", c.OIDCConfig.ClientID)
+	assert.Equal(t, "db.internal", c.RedisConfig.Host)
+	assert.Equal(t, "admin-pass", c.RedisConfig.Password)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "OIDC_CONFIG_CLIENTID=id-${secret:pg-pass}\n")
+
+	tomlPath := writeFile(t, "config.toml", "[postgres_config]\nhost = \"${PG_HOST}\"\n")
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFile(tomlPath),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", c.PostgresConfig.Host)
+
+	filePath = writeFile(
+		t, "invalid.yaml",
+		"postgres_config:\n"+
+			"  host: ${PG_USER:?must be set}\n"+
+			"  user: ${redis_config.user}\n"+
+			"redis_config:\n"+
+			"  user: ${postgres_config.user}\n",
+	)
+
+	c = newTestConfig()
+	err = c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+	)
+
+	var interpolationErr *InterpolationError
+	assert.ErrorAs(t, err, &interpolationErr)
+	assert.ErrorContains(t, err, filePath+":2: expand postgres_config.host: PG_USER: must be set")
+	assert.ErrorContains(
+		t, err,
+		filePath+":5: expand redis_config.user: reference cycle postgres_config.user -> redis_config.user -> "+
+			"postgres_config.user",
+	)
+}
+
+type serverConfig struct {
+	Timeout  time.Duration
+	Endpoint *url.URL
+	Backup   url.URL
+	IP       net.IP
+	Net      net.IPNet
+	Subnet   netip.Prefix
+	Level    slog.Level
+	MaxBody  ByteSize
+	Name     upperString
+}
+
+type upperString string
+
+type hooksConfig struct {
+	Embedding
+
+	Server serverConfig `mapstructure:"server"`
+}
+
+func TestEmbedding_DecodeHooks(t *testing.T) {
+	filePath := writeFile(
+		t, "config.yaml",
+		"server:\n  timeout: 5s\n  endpoint: https://api.example.com/v1\n  ip: 10.0.0.1\n  level: warn\n"+
+			"  maxbody: 512MiB\n  name: api\n",
+	)
+
+	t.Setenv("SERVER_SUBNET", "10.0.0.0/24")
+	t.Setenv("SERVER_NET", "10.0.0.0/8")
+	t.Setenv("SERVER_BACKUP", "https://backup.example.com")
+
+	upper := func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || to != reflect.TypeOf(upperString("")) {
+			return data, nil
+		}
+
+		return strings.ToUpper(data.(string)), nil
+	}
+
+	c := hooksConfig{}
+	err := c.Init(
+		&c,
+		WithConfigFile(filePath),
+		WithDecodeHooks(mapstructure.DecodeHookFuncType(upper)),
+		WithFlagSet(pflag.NewFlagSet("", pflag.ContinueOnError)),
+		WithArgs([]string{"--server.timeout=10s"}),
+	)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 10*time.Second, c.Server.Timeout)
+	assert.Equal(t, "https://api.example.com/v1", c.Server.Endpoint.String())
+	assert.Equal(t, "backup.example.com", c.Server.Backup.Host)
+	assert.Equal(t, net.ParseIP("10.0.0.1"), c.Server.IP)
+	assert.Equal(t, "10.0.0.0/8", c.Server.Net.String())
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/24"), c.Server.Subnet)
+	assert.Equal(t, slog.LevelWarn, c.Server.Level)
+	assert.Equal(t, 512*MiB, c.Server.MaxBody)
+	assert.Equal(t, upperString("API"), c.Server.Name)
+
+	buf := &bytes.Buffer{}
+	err = c.Echo(buf, FormatEnv)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "SERVER_ENDPOINT=https://api.example.com/v1\n")
+	assert.Contains(t, buf.String(), "SERVER_MAXBODY=512MiB\n")
+	assert.Contains(t, buf.String(), "SERVER_NET=10.0.0.0/8\n")
+	assert.Contains(t, buf.String(), "SERVER_LEVEL=WARN\n")
+}
+
+func TestByteSize(t *testing.T) {
+	for s, expected := range map[string]ByteSize{
+		"1024":   1024,
+		"512MiB": 512 * MiB,
+		"1.5 GB": 1500000000,
+		"2kib":   2 * KiB,
+		"0":      0,
+	} {
+		var size ByteSize
+
+		err := size.UnmarshalText([]byte(s))
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+
+	assert.Equal(t, "1500MB", ByteSize(1500000000).String())
+	assert.Equal(t, "1KiB", ByteSize(1024).String())
+	assert.Equal(t, "1001B", ByteSize(1001).String())
+
+	var size ByteSize
+
+	assert.Error(t, size.UnmarshalText([]byte("12XB")))
+	assert.Error(t, size.UnmarshalText([]byte("-1MB")))
+}
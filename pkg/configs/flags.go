@@ -0,0 +1,146 @@
+package configs
+
+import (
+	"encoding"
+	"github.com/spf13/pflag"
+	"reflect"
+	"time"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// registerFlags defines a typed flag for every leaf key of the config not defined in the flag set yet. Flag is named
+// after the key, e.g. --postgres_config.host, its default shown in help is the current value of the field and usage
+// is taken from `usage` tag, which vanya fills from the field comment. Defaults of secret fields are not shown in help.
+func registerFlags(flagSet *pflag.FlagSet, configPtr any) {
+	config := reflect.ValueOf(configPtr)
+
+	for _, f := range leafFields(config.Type()) {
+		name := f.key()
+		if flagSet.Lookup(name) != nil {
+			continue
+		}
+
+		value := fieldValue(config, f.index)
+		for value.IsValid() && value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+
+		if !value.IsValid() {
+			fieldType := f.typ
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+
+			value = reflect.Zero(fieldType)
+		}
+
+		if !defineFlag(flagSet, name, value, f.tag.Get("usage")) {
+			continue
+		}
+
+		if isSecret(f) {
+			flagSet.Lookup(name).DefValue = ""
+		}
+	}
+}
+
+// bindFlags binds flags set on command line to their keys. Flags which are not set are not bound, so viper does not
+// fall back to their defaults, which would override defaults of the config and fill optional pointer fields.
+func (e *Embedding) bindFlags(configType reflect.Type) error {
+	for _, f := range leafFields(configType) {
+		flag := e.flagSet.Lookup(f.key())
+		if flag == nil || !flag.Changed {
+			continue
+		}
+
+		err := e.viper.BindPFlag(f.key(), flag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defineFlag defines flag of the type matching the value. It reports false if the value could not be set from command
+// line, e.g. it is a slice of structs.
+func defineFlag(flagSet *pflag.FlagSet, name string, value reflect.Value, usage string) bool {
+	if value.Type() == durationType {
+		flagSet.Duration(name, time.Duration(value.Int()), usage)
+		return true
+	}
+
+	if stringStructTypes[value.Type()] {
+		flagSet.String(name, formatStringStruct(value), usage)
+		return true
+	}
+
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return false
+		}
+
+		flagSet.String(name, string(text), usage)
+
+		return true
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		flagSet.Bool(name, value.Bool(), usage)
+	case reflect.Int:
+		flagSet.Int(name, int(value.Int()), usage)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		flagSet.Int64(name, value.Int(), usage)
+	case reflect.Uint:
+		flagSet.Uint(name, uint(value.Uint()), usage)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		flagSet.Uint64(name, value.Uint(), usage)
+	case reflect.Float32, reflect.Float64:
+		flagSet.Float64(name, value.Float(), usage)
+	case reflect.String:
+		flagSet.String(name, value.String(), usage)
+	case reflect.Slice:
+		return defineSliceFlag(flagSet, name, value, usage)
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.String {
+			return false
+		}
+
+		m := make(map[string]string, value.Len())
+		for iter := value.MapRange(); iter.Next(); {
+			m[iter.Key().String()] = iter.Value().String()
+		}
+
+		flagSet.StringToString(name, m, usage)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func defineSliceFlag(flagSet *pflag.FlagSet, name string, value reflect.Value, usage string) bool {
+	switch value.Type().Elem().Kind() {
+	case reflect.String:
+		s := make([]string, value.Len())
+		for i := range s {
+			s[i] = value.Index(i).String()
+		}
+
+		flagSet.StringSlice(name, s, usage)
+	case reflect.Int:
+		s := make([]int, value.Len())
+		for i := range s {
+			s[i] = int(value.Index(i).Int())
+		}
+
+		flagSet.IntSlice(name, s, usage)
+	default:
+		return false
+	}
+
+	return true
+}
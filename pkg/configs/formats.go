@@ -0,0 +1,321 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/magiconair/properties"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/subosito/gotenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Encoder writes config values nested by keys, e.g. {"postgres_config": {"host": "localhost"}}, in a format.
+type Encoder func(w io.Writer, m map[string]any) error
+
+// Decoder reads config values nested by keys from a file.
+type Decoder func(r io.Reader) (map[string]any, error)
+
+type formatCodec struct {
+	encoder Encoder
+	decoder Decoder
+}
+
+var formats = struct {
+	mu sync.RWMutex
+	// codecs are encoders and decoders by format.
+	codecs map[Format]formatCodec
+	// extensions are formats by file extensions loaded with registered decoders.
+	extensions map[string]Format
+}{
+	codecs:     make(map[Format]formatCodec),
+	extensions: make(map[string]Format),
+}
+
+// RegisterFormat registers format printed by Echo with encoder. If decoder is set, files with the extensions, e.g.
+// "ini", are loaded with it instead of viper. Registering the format again replaces its codec. FormatEnv,
+// FormatDotenv and FormatSources depend on the config and could not be replaced.
+func RegisterFormat(format Format, encoder Encoder, decoder Decoder, extensions ...string) {
+	formats.mu.Lock()
+	defer formats.mu.Unlock()
+
+	formats.codecs[format] = formatCodec{encoder: encoder, decoder: decoder}
+
+	if decoder == nil {
+		return
+	}
+
+	for _, ext := range extensions {
+		formats.extensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = format
+	}
+}
+
+func lookupEncoder(format Format) (Encoder, bool) {
+	formats.mu.RLock()
+	defer formats.mu.RUnlock()
+
+	codec, ok := formats.codecs[format]
+	if !ok || codec.encoder == nil {
+		return nil, false
+	}
+
+	return codec.encoder, true
+}
+
+// lookupDecoder returns registered decoder of files with the path extension.
+func lookupDecoder(filePath string) (Decoder, bool) {
+	formats.mu.RLock()
+	defer formats.mu.RUnlock()
+
+	format, ok := formats.extensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), "."))]
+	if !ok || formats.codecs[format].decoder == nil {
+		return nil, false
+	}
+
+	return formats.codecs[format].decoder, true
+}
+
+func init() {
+	// files of these formats are loaded by viper
+	RegisterFormat(FormatJSON, encodeJSON, nil)
+	RegisterFormat(FormatYaml, encodeYaml, nil)
+	RegisterFormat(FormatToml, encodeToml, nil)
+	RegisterFormat(FormatProperties, encodeProperties, nil)
+	RegisterFormat(FormatHcl, encodeHcl, decodeHcl, "hcl", "tfvars")
+}
+
+func encodeJSON(w io.Writer, m map[string]any) error {
+	encoder := json.NewEncoder(w)
+
+	encoder.SetIndent("", "\t")
+	err := encoder.Encode(m)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func encodeYaml(w io.Writer, m map[string]any) error {
+	encoder := yaml.NewEncoder(w)
+
+	encoder.SetIndent(2)
+	err := encoder.Encode(m)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func encodeToml(w io.Writer, m map[string]any) error {
+	return toml.NewEncoder(w).Encode(m)
+}
+
+// encodeProperties writes every key as a separate property, e.g. postgres_config.host = localhost.
+func encodeProperties(w io.Writer, m map[string]any) error {
+	p := properties.NewProperties()
+	p.DisableExpansion = true
+
+	lines := flatten(m)
+	for _, line := range lines {
+		_, _, err := p.Set(strings.Join(line.path, keyDelimiter), formatValue(line.value))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := p.Write(w, properties.UTF8)
+
+	return err
+}
+
+// encodeHcl converts JSON to HCL the same way viper does.
+func encodeHcl(w io.Writer, m map[string]any) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+
+	err = printer.Fprint(w, file.Node)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+
+	return err
+}
+
+// decodeHcl reads HCL file. Unlike viper, blocks are decoded as nested maps rather than lists of them.
+func decodeHcl(r io.Reader) (map[string]any, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+
+	err = hcl.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrapHclBlocks(m).(map[string]any), nil
+}
+
+func unwrapHclBlocks(value any) any {
+	switch v := value.(type) {
+	case []map[string]any:
+		merged := make(map[string]any)
+		for _, block := range v {
+			for key, value := range block {
+				merged[key] = unwrapHclBlocks(value)
+			}
+		}
+
+		return merged
+	case map[string]any:
+		for key, value := range v {
+			v[key] = unwrapHclBlocks(value)
+		}
+
+		return v
+	}
+
+	return value
+}
+
+type flatValue struct {
+	path  []string
+	value any
+}
+
+// flatten returns values of m which are not nested maps sorted by their paths.
+func flatten(m map[string]any) []flatValue {
+	values := make([]flatValue, 0)
+
+	walkMap(
+		m, nil, func(path []string, value any) {
+			values = append(values, flatValue{path: path, value: value})
+		},
+	)
+
+	sort.Slice(
+		values, func(i, j int) bool {
+			return strings.Join(values[i].path, keyDelimiter) < strings.Join(values[j].path, keyDelimiter)
+		},
+	)
+
+	return values
+}
+
+// formatValue formats value of environment variable or property. Slices are joined with commas, as viper splits
+// strings decoded into slices by them. Maps are formatted as comma-separated key=value pairs sorted by keys, which
+// are decoded back by stringToMapHookFunc.
+func formatValue(value any) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Map {
+		pairs := make([]string, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", iter.Key().Interface(), iter.Value().Interface()))
+		}
+
+		sort.Strings(pairs)
+
+		return strings.Join(pairs, ",")
+	}
+
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return fmt.Sprint(value)
+	}
+
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+
+	return strings.Join(items, ",")
+}
+
+var dotenvBareValue = regexp.MustCompile(`^[A-Za-z0-9_./:@,+-]*$`)
+
+// quoteDotenv quotes value, so it is read back as is. Single quotes are preferred, as nothing is expanded or unescaped
+// in them. Values containing quote or line break are double-quoted, in which case backslash followed by n or r could
+// not be preserved, as dotenv parser replaces such sequences with line breaks before unescaping.
+func quoteDotenv(value string) string {
+	switch {
+	case dotenvBareValue.MatchString(value):
+		return value
+	case !strings.ContainsAny(value, "'\r\n"):
+		return "'" + value + "'"
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// readDotenv reads file of environment variables named as printed by Echo in FormatDotenv. Variables matching no
+// config field are kept under their lowercase names, so strict mode reports them.
+func (e *Embedding) readDotenv(filePath string, configType reflect.Type) (map[string]any, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	env, err := gotenv.StrictParse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string][]string)
+	for _, f := range leafFields(configType) {
+		paths[envVarName(e.envPrefix, f.path)] = f.path
+	}
+
+	m := make(map[string]any)
+
+	for name, value := range env {
+		path, ok := paths[name]
+		if !ok {
+			path = []string{strings.ToLower(name)}
+		}
+
+		setNested(m, path, value)
+	}
+
+	return m, nil
+}
+
+// setNested sets value of the key path in m creating nested maps.
+func setNested(m map[string]any, path []string, value any) {
+	parent := m
+	for _, key := range path[:len(path)-1] {
+		child, ok := parent[key].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			parent[key] = child
+		}
+
+		parent = child
+	}
+
+	parent[path[len(path)-1]] = value
+}
@@ -0,0 +1,196 @@
+package configs
+
+import (
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	urlType    = reflect.TypeOf(url.URL{})
+	urlPtrType = reflect.TypeOf(&url.URL{})
+	ipNetType  = reflect.TypeOf(net.IPNet{})
+	// stringStructTypes are structs decoded from strings by hooks rather than key by key. They are formatted with their
+	// String method.
+	stringStructTypes = map[reflect.Type]bool{urlType: true, ipNetType: true}
+)
+
+// formatStringStruct formats value of one of stringStructTypes, so it is decoded back by hooks. Zero value is formatted
+// as empty string.
+func formatStringStruct(value reflect.Value) string {
+	if value.IsZero() {
+		return ""
+	}
+
+	ptr := reflect.New(value.Type())
+	ptr.Elem().Set(value)
+
+	return ptr.Interface().(fmt.Stringer).String()
+}
+
+// WithDecodeHooks registers mapstructure hooks converting loaded values to field types. Custom hooks run before the
+// built-in ones, which decode time.Duration, url.URL, net.IP, net.IPNet, ByteSize, comma-separated slices, maps of
+// key=value pairs and types implementing encoding.TextUnmarshaler, e.g. netip.Prefix or slog.Level.
+func WithDecodeHooks(hooks ...mapstructure.DecodeHookFunc) Option {
+	return func(p *Embedding) {
+		p.decodeHooks = append(p.decodeHooks, hooks...)
+	}
+}
+
+// decodeHook composes hooks applied by viper.Unmarshal. References to secrets are resolved first, so the other hooks
+// get the secret values.
+func (e *Embedding) decodeHook() mapstructure.DecodeHookFunc {
+	hooks := []mapstructure.DecodeHookFunc{e.secrets.decodeHook()}
+	hooks = append(hooks, e.decodeHooks...)
+	hooks = append(
+		hooks,
+		mapstructure.StringToTimeDurationHookFunc(),
+		stringToURLHookFunc(),
+		mapstructure.StringToIPHookFunc(),
+		mapstructure.StringToIPNetHookFunc(),
+		mapstructure.TextUnmarshallerHookFunc(),
+		stringToMapHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)
+
+	return mapstructure.ComposeDecodeHookFunc(hooks...)
+}
+
+// stringToMapHookFunc decodes maps from comma-separated key=value pairs, e.g. team=core,tier=1, as printed by Echo in
+// FormatEnv. Keys and values containing commas could not be decoded this way.
+func stringToMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+			return data, nil
+		}
+
+		m := make(map[string]string)
+
+		s := strings.TrimSpace(data.(string))
+		if s == "" {
+			return m, nil
+		}
+
+		for _, pair := range strings.Split(s, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid map entry %q, expected key=value", pair)
+			}
+
+			m[strings.TrimSpace(key)] = value
+		}
+
+		return m, nil
+	}
+}
+
+func stringToURLHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String || (to != urlType && to != urlPtrType) {
+			return data, nil
+		}
+
+		u, err := url.Parse(data.(string))
+		if err != nil {
+			return nil, err
+		}
+
+		if to == urlType {
+			return *u, nil
+		}
+
+		return u, nil
+	}
+}
+
+// ByteSize is a size in bytes loaded from human-readable string, e.g. 512MiB or 1.5GB, or from a number of bytes.
+// Units are case-insensitive: B, KB, MB, GB, TB and PB are powers of 1000, KiB, MiB, GiB, TiB and PiB are powers
+// of 1024.
+type ByteSize uint64
+
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+	PiB
+)
+
+var byteUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	{"PB", 1e15}, {"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+	{"B", 1},
+}
+
+// String returns size in the largest unit dividing it, e.g. 512MiB, so it is parsed back to the same value.
+func (s ByteSize) String() string {
+	for _, unit := range byteUnits {
+		if s != 0 && s%unit.size == 0 {
+			return strconv.FormatUint(uint64(s/unit.size), 10) + unit.name
+		}
+	}
+
+	return "0B"
+}
+
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	size, err := parseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = size
+
+	return nil
+}
+
+func parseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+
+	number := strings.TrimRightFunc(
+		s, func(r rune) bool {
+			return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		},
+	)
+	unitName := strings.TrimSpace(s[len(number):])
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+
+	unit := ByteSize(1)
+	if unitName != "" {
+		unit = 0
+
+		for _, u := range byteUnits {
+			if strings.EqualFold(u.name, unitName) {
+				unit = u.size
+				break
+			}
+		}
+
+		if unit == 0 {
+			return 0, fmt.Errorf("unknown unit of byte size %q", s)
+		}
+	}
+
+	size := value * float64(unit)
+	if size >= math.MaxUint64 {
+		return 0, fmt.Errorf("byte size %q overflows", s)
+	}
+
+	return ByteSize(size), nil
+}
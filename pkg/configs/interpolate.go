@@ -0,0 +1,283 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InterpolationError reports a value of the config file which could not be expanded.
+type InterpolationError struct {
+	Key    string
+	Source Source
+	Err    error
+}
+
+func (e *InterpolationError) Error() string {
+	if e.Source.Line > 0 {
+		return fmt.Sprintf("%s:%d: expand %s: %s", e.Source.Name, e.Source.Line, e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("%s: expand %s: %s", e.Source.Name, e.Key, e.Err)
+}
+
+func (e *InterpolationError) Unwrap() error {
+	return e.Err
+}
+
+// interpolatedExtensions are extensions of config files which string values are expanded.
+var interpolatedExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true, ".toml": true}
+
+// interpolator expands references in string values of merged config files. ${VAR} is replaced with environment
+// variable, while names containing dot, e.g. ${postgres_config.host}, refer to other keys of the files. ${VAR:-default}
+// falls back to default if the variable is unset or empty, ${VAR:?message} fails with the message instead. $${VAR} is
+// kept as ${VAR}. Inline references to secrets, e.g. ${secret:pg-pass}, and escaped ones are left to secret providers.
+type interpolator struct {
+	values  map[string]any
+	sources map[string]Source
+	// expanded holds keys which values are already expanded, with the error if expansion failed.
+	expanded map[string]error
+	// stack holds keys being expanded to detect cycles of references.
+	stack []string
+}
+
+// interpolate expands string values of the merged config files in place. Values of other formats are kept as is.
+func interpolate(values map[string]any, sources map[string]Source) error {
+	i := &interpolator{
+		values:   values,
+		sources:  sources,
+		expanded: make(map[string]error),
+	}
+
+	errs := make([]error, 0)
+	reported := make(map[error]bool)
+
+	for _, v := range flatten(values) {
+		err := i.expandKey(strings.Join(v.path, keyDelimiter))
+		if err != nil && !reported[err] {
+			reported[err] = true
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// expandKey expands value of the key in place once. Error is reported for the key where expansion failed, and keys
+// referring to it return the same error.
+func (i *interpolator) expandKey(key string) error {
+	if err, ok := i.expanded[key]; ok {
+		return err
+	}
+
+	parent, name, ok := i.lookup(key)
+	if !ok || !i.interpolated(key) {
+		return nil
+	}
+
+	i.stack = append(i.stack, key)
+	defer func() {
+		i.stack = i.stack[:len(i.stack)-1]
+	}()
+
+	var err error
+
+	switch value := parent[name].(type) {
+	case string:
+		parent[name], err = i.expand(value)
+	case []any:
+		for j, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				continue
+			}
+
+			value[j], err = i.expand(s)
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	var interpolationErr *InterpolationError
+	if err != nil && !errors.As(err, &interpolationErr) {
+		err = &InterpolationError{Key: key, Source: i.sources[key], Err: err}
+	}
+
+	i.expanded[key] = err
+
+	return err
+}
+
+// expand replaces references in s.
+func (i *interpolator) expand(s string) (string, error) {
+	var b strings.Builder
+
+	for pos := 0; pos < len(s); {
+		switch {
+		case strings.HasPrefix(s[pos:], "$${secret:"):
+			// escaped references to secrets are unescaped by secret resolver, so they are not resolved
+			b.WriteString("$${")
+			pos += 3
+
+			continue
+		case strings.HasPrefix(s[pos:], "$${"):
+			b.WriteString("${")
+			pos += 3
+
+			continue
+		case !strings.HasPrefix(s[pos:], "${"):
+			b.WriteByte(s[pos])
+			pos++
+
+			continue
+		}
+
+		end := closingBrace(s, pos+2)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference %s", s[pos:])
+		}
+
+		expr := s[pos+2 : end]
+		if strings.HasPrefix(expr, "secret:") {
+			b.WriteString(s[pos : end+1])
+			pos = end + 1
+
+			continue
+		}
+
+		value, err := i.expandExpr(expr)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(value)
+		pos = end + 1
+	}
+
+	return b.String(), nil
+}
+
+// expandExpr expands reference without braces, e.g. VAR:-default.
+func (i *interpolator) expandExpr(expr string) (string, error) {
+	name, arg, op := expr, "", ""
+
+	if idx := strings.IndexByte(expr, ':'); idx >= 0 {
+		name, op, arg = expr[:idx], expr[idx:min(idx+2, len(expr))], expr[min(idx+2, len(expr)):]
+	}
+
+	if !isReferenceName(name) || (op != "" && op != ":-" && op != ":?") {
+		return "", fmt.Errorf("invalid reference ${%s}", expr)
+	}
+
+	value, err := i.resolve(name)
+	if err != nil || value != "" {
+		return value, err
+	}
+
+	switch op {
+	case ":-":
+		return i.expand(arg)
+	case ":?":
+		if arg == "" {
+			arg = "is not set"
+		}
+
+		return "", fmt.Errorf("%s: %s", name, arg)
+	}
+
+	return "", nil
+}
+
+// resolve returns value of the environment variable or of the config key, if the name contains dot.
+func (i *interpolator) resolve(name string) (string, error) {
+	if !strings.Contains(name, keyDelimiter) {
+		return os.Getenv(name), nil
+	}
+
+	key := strings.ToLower(name)
+
+	for j, k := range i.stack {
+		if k == key {
+			cycle := append(append([]string{}, i.stack[j:]...), key)
+			return "", fmt.Errorf("reference cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	err := i.expandKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	parent, name, ok := i.lookup(key)
+	if !ok {
+		return "", nil
+	}
+
+	if _, ok := parent[name].(map[string]any); ok {
+		return "", fmt.Errorf("%s refers to a section", key)
+	}
+
+	return formatValue(parent[name]), nil
+}
+
+// lookup returns map holding the key and the last element of the key.
+func (i *interpolator) lookup(key string) (map[string]any, string, bool) {
+	path := strings.Split(key, keyDelimiter)
+
+	parent := i.values
+	for _, name := range path[:len(path)-1] {
+		child, ok := parent[name].(map[string]any)
+		if !ok {
+			return nil, "", false
+		}
+
+		parent = child
+	}
+
+	_, ok := parent[path[len(path)-1]]
+
+	return parent, path[len(path)-1], ok
+}
+
+// interpolated reports whether the key is set by file of the format which values are expanded.
+func (i *interpolator) interpolated(key string) bool {
+	source, ok := i.sources[key]
+
+	return ok && interpolatedExtensions[strings.ToLower(filepath.Ext(source.Name))]
+}
+
+// closingBrace returns index of the brace closing reference started before pos, skipping nested references.
+func closingBrace(s string, pos int) int {
+	depth := 0
+
+	for ; pos < len(s); pos++ {
+		switch {
+		case strings.HasPrefix(s[pos:], "${"):
+			depth++
+			pos++
+		case s[pos] == '}' && depth == 0:
+			return pos
+		case s[pos] == '}':
+			depth--
+		}
+	}
+
+	return -1
+}
+
+func isReferenceName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r == '_' || r == '.' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
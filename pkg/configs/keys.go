@@ -0,0 +1,163 @@
+package configs
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+)
+
+const keyDelimiter = "."
+
+var (
+	embeddingType       = reflect.TypeOf(Embedding{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// field is a field of config struct addressed by viper key, e.g. postgres_config.host.
+type field struct {
+	path  []string
+	index []int
+	typ   reflect.Type
+	tag   reflect.StructTag
+	// nested fields are structs having their own keys.
+	nested bool
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, keyDelimiter)
+}
+
+// allFields returns fields of the config struct, both leaf and nested, named the same way mapstructure decodes them.
+func allFields(t reflect.Type) []field {
+	fields := make([]field, 0)
+	collectFields(t, nil, nil, &fields)
+
+	return fields
+}
+
+// leafFields returns fields of the config struct having no nested keys.
+func leafFields(t reflect.Type) []field {
+	fields := make([]field, 0)
+
+	for _, f := range allFields(t) {
+		if !f.nested {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// findField returns the field addressed by the key.
+func findField(t reflect.Type, key string) (field, bool) {
+	key = strings.ToLower(key)
+
+	for _, f := range allFields(t) {
+		if f.key() == key {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+// fieldValue returns value of the field in config value v. Invalid value is returned when one of the structs on the
+// way is nil pointer.
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(i)
+	}
+
+	return v
+}
+
+func collectFields(t reflect.Type, path []string, index []int, fields *[]field) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		if structField.Type == embeddingType || !structField.IsExported() {
+			continue
+		}
+
+		name, squash := fieldName(structField)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+		fieldType := structField.Type
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		nested := isNested(fieldType)
+		if nested && squash {
+			collectFields(fieldType, path, fieldIndex, fields)
+			continue
+		}
+
+		fieldPath := append(append(make([]string, 0, len(path)+1), path...), name)
+
+		*fields = append(
+			*fields, field{
+				path:   fieldPath,
+				index:  fieldIndex,
+				typ:    structField.Type,
+				tag:    structField.Tag,
+				nested: nested,
+			},
+		)
+
+		if nested {
+			collectFields(fieldType, fieldPath, fieldIndex, fields)
+		}
+	}
+}
+
+// fieldName returns the key of the field from mapstructure tag, falling back to lowercase field name as viper keys are
+// case-insensitive.
+func fieldName(structField reflect.StructField) (string, bool) {
+	tag := structField.Tag.Get("mapstructure")
+	name, opts, _ := strings.Cut(tag, ",")
+
+	squash := false
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "squash" {
+			squash = true
+		}
+	}
+
+	if name == "" {
+		name = structField.Name
+	}
+
+	return strings.ToLower(name), squash
+}
+
+// isNested reports whether values of the type are decoded key by key rather than from a single value.
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !stringStructTypes[t] && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// envVarName returns environment variable holding the key: path is joined with underscores, upper-cased and prefixed
+// with envPrefix the same way viper does.
+func envVarName(envPrefix string, path []string) string {
+	name := strings.ToUpper(strings.Join(path, "_"))
+	if envPrefix == "" {
+		return name
+	}
+
+	return strings.ToUpper(envPrefix) + "_" + name
+}
@@ -0,0 +1,221 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// configLayer is a config file merged on top of the previous ones.
+type configLayer struct {
+	path string
+	// optional layers are skipped if the file does not exist.
+	optional bool
+}
+
+// localProfile names optional file with developer overrides, e.g. config.local.yaml, merged when profile is set.
+const localProfile = "local"
+
+// configLayers returns config files in the order they are merged: base file, its profile file, overlays and local
+// overrides.
+func (e *Embedding) configLayers() []configLayer {
+	if len(e.filePaths) == 0 {
+		return nil
+	}
+
+	base := e.filePaths[0]
+	layers := []configLayer{{path: base}}
+
+	if e.profile != "" {
+		layers = append(layers, configLayer{path: profilePath(base, e.profile)})
+	}
+
+	for _, overlay := range e.filePaths[1:] {
+		layers = append(layers, configLayer{path: overlay})
+	}
+
+	if e.profile != "" {
+		layers = append(layers, configLayer{path: profilePath(base, localProfile), optional: true})
+	}
+
+	return layers
+}
+
+// profilePath inserts profile before the extension, e.g. config.yaml becomes config.staging.yaml.
+func profilePath(filePath, profile string) string {
+	ext := filepath.Ext(filePath)
+
+	return strings.TrimSuffix(filePath, ext) + "." + profile + ext
+}
+
+// configState holds values of config files and secret files passed to viper as config, along with their sources.
+type configState struct {
+	values        map[string]any
+	fileSources   map[string]Source
+	secretSources map[string]Source
+}
+
+// loadConfig reads config files and secret files without passing them to viper, so failed reload does not affect the
+// loaded config.
+func (e *Embedding) loadConfig(configType reflect.Type) (configState, error) {
+	values, fileSources, err := e.readConfig(configType)
+	if err != nil {
+		return configState{}, err
+	}
+
+	secrets, secretSources, err := e.readSecretFiles(configType)
+	if err != nil {
+		return configState{}, err
+	}
+
+	mergeMaps(values, secrets)
+
+	return configState{values: values, fileSources: fileSources, secretSources: secretSources}, nil
+}
+
+// applyConfig passes values of the state to viper as config and records sources of the keys for provenance.
+func (e *Embedding) applyConfig(state configState) error {
+	err := e.setConfig(state.values)
+	if err != nil {
+		return err
+	}
+
+	e.fileSources = state.fileSources
+	e.secretSources = state.secretSources
+
+	return nil
+}
+
+// readConfig reads config files deep-merging each of them into the previous ones and expands references in their
+// values. Sources of the keys are returned along with the values.
+func (e *Embedding) readConfig(configType reflect.Type) (map[string]any, map[string]Source, error) {
+	merged := make(map[string]any)
+	sources := make(map[string]Source)
+
+	for _, layer := range e.layers {
+		_, err := os.Stat(layer.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			if layer.optional {
+				continue
+			}
+
+			return nil, nil, fmt.Errorf("required config file %s does not exist", layer.path)
+		}
+
+		m, err := e.readFile(layer.path, configType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read config file %s: %w", layer.path, err)
+		}
+
+		lines := keyLines(layer.path)
+
+		walkMap(
+			m, nil, func(path []string, _ any) {
+				key := strings.ToLower(strings.Join(path, keyDelimiter))
+				sources[key] = Source{Kind: SourceFile, Name: layer.path, Line: lines[key]}
+			},
+		)
+
+		mergeMaps(merged, m)
+	}
+
+	err := interpolate(merged, sources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return merged, sources, nil
+}
+
+// setConfig passes values to viper as config. If config files are set, config read before is dropped, so keys removed
+// from the files are not kept on reload. Otherwise, values are merged into config of viper passed by WithViper.
+func (e *Embedding) setConfig(values map[string]any) error {
+	if len(e.layers) > 0 {
+		e.viper.SetConfigType("json")
+
+		err := e.viper.ReadConfig(strings.NewReader("{}"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	return e.viper.MergeConfigMap(values)
+}
+
+// readFile decodes the config file into values nested by keys. Dotenv files and files of registered formats are
+// decoded here, other formats are read by viper.
+func (e *Embedding) readFile(filePath string, configType reflect.Type) (map[string]any, error) {
+	if decoder, ok := lookupDecoder(filePath); ok {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		return decoder(file)
+	}
+
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), ".")) {
+	case "env", "dotenv":
+		return e.readDotenv(filePath, configType)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(filePath)
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return v.AllSettings(), nil
+}
+
+// mergeMaps deep-merges src into dst: nested maps are merged key by key, other values are replaced.
+func mergeMaps(dst, src map[string]any) {
+	for key, value := range src {
+		key = strings.ToLower(key)
+
+		srcMap, srcOk := value.(map[string]any)
+		dstMap, dstOk := dst[key].(map[string]any)
+
+		if srcOk && dstOk {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+
+		if srcOk {
+			copied := make(map[string]any, len(srcMap))
+			mergeMaps(copied, srcMap)
+			value = copied
+		}
+
+		dst[key] = value
+	}
+}
+
+// fileSource returns source of the key set by config files. Keys of map fields are set by their entries.
+func (e *Embedding) fileSource(key string) (Source, bool) {
+	source, ok := e.fileSources[key]
+	if ok {
+		return source, true
+	}
+
+	for k, source := range e.fileSources {
+		if strings.HasPrefix(k, key+keyDelimiter) {
+			return source, true
+		}
+	}
+
+	return Source{}, false
+}
@@ -1,36 +1,36 @@
 package configs
 
 type HttpServerConfig struct {
-	Host string
-	Port string
+	Host string `mapstructure:"host" usage:"HTTP server listening host, empty to listen on all interfaces."`
+	Port string `mapstructure:"port" validate:"port" usage:"HTTP server listening port."`
 }
 
 type GrpcServerConfig struct {
-	Host string
-	Port string
+	Host string `mapstructure:"host" usage:"gRPC server listening host, empty to listen on all interfaces."`
+	Port string `mapstructure:"port" validate:"port" usage:"gRPC server listening port."`
 }
 
 type PostgresConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Database string
+	Host     string `mapstructure:"host" validate:"required" usage:"PostgreSQL host."`
+	Port     string `mapstructure:"port" validate:"port" usage:"PostgreSQL port."`
+	User     string `mapstructure:"user" usage:"PostgreSQL user."`
+	Password string `mapstructure:"password" secret:"true" usage:"PostgreSQL password."`
+	Database string `mapstructure:"database" usage:"PostgreSQL database name."`
 }
 
 type RedisConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DB       int
+	Host     string `mapstructure:"host" validate:"required" usage:"Redis host."`
+	Port     string `mapstructure:"port" validate:"port" usage:"Redis port."`
+	User     string `mapstructure:"user" usage:"Redis user."`
+	Password string `mapstructure:"password" secret:"true" usage:"Redis password."`
+	DB       int    `mapstructure:"db" validate:"min=0" usage:"Redis database number."`
 }
 
 type RabbitMQConfig struct {
-	Host string
-	Port string
+	Host string `mapstructure:"host" validate:"required" usage:"RabbitMQ host."`
+	Port string `mapstructure:"port" validate:"port" usage:"RabbitMQ port."`
 }
 
 type LoggerConfig struct {
-	Level string
+	Level string `mapstructure:"level" validate:"oneof=debug info warn error" usage:"Log level: debug, info, warn or error."`
 }
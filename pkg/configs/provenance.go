@@ -0,0 +1,199 @@
+package configs
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type SourceKind string
+
+const (
+	SourceDefault SourceKind = "default"
+	SourceFile    SourceKind = "file"
+	SourceEnv     SourceKind = "env"
+	SourceFlag    SourceKind = "flag"
+	// SourceSecretFile is a file set by environment variable with _FILE suffix or placed in the secrets directory.
+	SourceSecretFile SourceKind = "secret_file"
+)
+
+// Source describes where the value of a config key came from.
+type Source struct {
+	Kind SourceKind
+	// Name is the file path, the environment variable or the flag name. It is empty for defaults.
+	Name string
+	// Line is the line of the key in the file, if known.
+	Line int
+}
+
+func (s Source) String() string {
+	switch {
+	case s.Name == "":
+		return string(s.Kind)
+	case s.Kind == SourceFlag:
+		return fmt.Sprintf("%s --%s", s.Kind, s.Name)
+	case s.Line > 0:
+		return fmt.Sprintf("%s %s:%d", s.Kind, s.Name, s.Line)
+	default:
+		return fmt.Sprintf("%s %s", s.Kind, s.Name)
+	}
+}
+
+// provenance holds sources of the loaded config keys and keys holding secrets. It is shared by copies of Embedding
+// and updated on reload.
+type provenance struct {
+	mu         sync.RWMutex
+	sources    map[string]Source
+	secretKeys map[string]bool
+}
+
+func (p *provenance) set(sources map[string]Source, secretKeys map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sources = sources
+	p.secretKeys = secretKeys
+}
+
+// loadedSecretKeys returns keys holding secrets of the loaded config, see secretKeys.
+func (e *Embedding) loadedSecretKeys() map[string]bool {
+	if e.provenance == nil {
+		return nil
+	}
+
+	e.provenance.mu.RLock()
+	defer e.provenance.mu.RUnlock()
+
+	return e.provenance.secretKeys
+}
+
+// Sources returns sources of the loaded config keys, e.g. redis_config.port, in the order of viper precedence: flag,
+// environment variable, secret file, config file and the default value the config was initialized with. Keys set by
+// several config files come from the last of them.
+func (e *Embedding) Sources() map[string]Source {
+	if e.provenance == nil {
+		return nil
+	}
+
+	e.provenance.mu.RLock()
+	defer e.provenance.mu.RUnlock()
+
+	sources := make(map[string]Source, len(e.provenance.sources))
+	for key, source := range e.provenance.sources {
+		sources[key] = source
+	}
+
+	return sources
+}
+
+// Source returns source of the loaded config key.
+func (e *Embedding) Source(key string) (Source, bool) {
+	if e.provenance == nil {
+		return Source{}, false
+	}
+
+	e.provenance.mu.RLock()
+	defer e.provenance.mu.RUnlock()
+
+	source, ok := e.provenance.sources[strings.ToLower(key)]
+
+	return source, ok
+}
+
+// resolveSources determines the source of every leaf key of the config the same way viper resolves values.
+func (e *Embedding) resolveSources(configType reflect.Type) map[string]Source {
+	sources := make(map[string]Source)
+
+	for _, f := range leafFields(configType) {
+		key := f.key()
+
+		if flag := e.flagSet.Lookup(key); flag != nil && flag.Changed {
+			sources[key] = Source{Kind: SourceFlag, Name: flag.Name}
+			continue
+		}
+
+		envVar := envVarName(e.envPrefix, f.path)
+		if value, ok := os.LookupEnv(envVar); ok && value != "" {
+			sources[key] = Source{Kind: SourceEnv, Name: envVar}
+			continue
+		}
+
+		if source, ok := e.secretSources[key]; ok {
+			sources[key] = source
+			continue
+		}
+
+		if source, ok := e.fileSource(key); ok {
+			sources[key] = source
+			continue
+		}
+
+		sources[key] = Source{Kind: SourceDefault}
+	}
+
+	return sources
+}
+
+// keyLines returns lines of keys in YAML or JSON file. Lines of other formats are not tracked.
+func keyLines(filePath string) map[string]int {
+	lines := make(map[string]int)
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return lines
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return lines
+	}
+
+	// JSON is a subset of YAML, so both are parsed the same way
+	root := &yaml.Node{}
+
+	err = yaml.Unmarshal(data, root)
+	if err != nil || len(root.Content) == 0 {
+		return lines
+	}
+
+	collectLines(root.Content[0], nil, lines)
+
+	return lines
+}
+
+func collectLines(node *yaml.Node, path []string, lines map[string]int) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+
+		keyPath := append(append(make([]string, 0, len(path)+1), path...), strings.ToLower(keyNode.Value))
+		lines[strings.Join(keyPath, keyDelimiter)] = keyNode.Line
+
+		collectLines(valueNode, keyPath, lines)
+	}
+}
+
+// echoSources prints every key with its value and source, e.g. redis_config.port=6379 # env APP_REDIS_CONFIG_PORT.
+func (e *Embedding) echoSources(m map[string]any, w io.Writer) error {
+	sources := e.Sources()
+
+	for _, v := range flatten(m) {
+		key := strings.Join(v.path, keyDelimiter)
+
+		_, err := fmt.Fprintf(w, "%s=%s # %s\n", key, formatValue(v.value), sources[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultSecretProvider is the name of the provider resolving inline references, which do not name provider, e.g.
+// ${secret:pg-pass}.
+const DefaultSecretProvider = "default"
+
+// SecretRef is a reference to a secret in config value. Value secret://vault/db#password refers to field password of
+// secret db of provider vault. Inline reference ${secret:db#password} embedded into string refers to the same secret
+// of DefaultSecretProvider, or of the only registered provider. Escaped inline reference $${secret:db} is kept as
+// ${secret:db}.
+type SecretRef struct {
+	Provider string
+	Path     string
+	// Field is the field of structured secret, if set.
+	Field string
+}
+
+func (r SecretRef) String() string {
+	s := "secret://" + r.Provider + "/" + r.Path
+	if r.Field != "" {
+		s += "#" + r.Field
+	}
+
+	return s
+}
+
+// SecretProvider resolves references to secrets of the provider, e.g. kept in Vault or cloud secret manager.
+type SecretProvider interface {
+	Secret(ref SecretRef) (string, error)
+}
+
+// SecretRefError reports a reference which could not be resolved.
+type SecretRefError struct {
+	Ref SecretRef
+	Err error
+}
+
+func (e *SecretRefError) Error() string {
+	return fmt.Sprintf("resolve %s: %s", e.Ref, e.Err)
+}
+
+func (e *SecretRefError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	secretURLRef = regexp.MustCompile(`^secret://([^/]+)/([^#]+)(?:#(.+))?$`)
+	// inlineSecretRef matches escaped references, e.g. $${secret:pg-pass}, too, so they are unescaped on resolving.
+	inlineSecretRef = regexp.MustCompile(`\$?\$\{secret:([^}#]+)(?:#([^}]+))?\}`)
+)
+
+// hasSecretRef reports whether the value is a reference to secret or contains inline references. Escaped references
+// are not counted.
+func hasSecretRef(value string) bool {
+	if secretURLRef.MatchString(value) {
+		return true
+	}
+
+	for _, ref := range inlineSecretRef.FindAllString(value, -1) {
+		if !strings.HasPrefix(ref, "$$") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// secretResolver resolves references with registered providers caching resolved secrets. It is shared by copies of
+// Embedding, and the cache is reset on reload, so rotated secrets are fetched again.
+type secretResolver struct {
+	mu        sync.Mutex
+	providers map[string]SecretProvider
+	cache     map[SecretRef]string
+}
+
+func newSecretResolver() *secretResolver {
+	return &secretResolver{
+		providers: make(map[string]SecretProvider),
+		cache:     make(map[SecretRef]string),
+	}
+}
+
+func (r *secretResolver) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache = make(map[SecretRef]string)
+}
+
+// resolve replaces references in the value with secrets. Every failed reference is reported with SecretRefError.
+func (r *secretResolver) resolve(value string) (string, error) {
+	if match := secretURLRef.FindStringSubmatch(value); match != nil {
+		return r.secret(SecretRef{Provider: match[1], Path: match[2], Field: match[3]})
+	}
+
+	errs := make([]error, 0)
+
+	resolved := inlineSecretRef.ReplaceAllStringFunc(
+		value, func(s string) string {
+			if strings.HasPrefix(s, "$$") {
+				return s[1:]
+			}
+
+			match := inlineSecretRef.FindStringSubmatch(s)
+
+			secret, err := r.secret(SecretRef{Provider: r.defaultProvider(), Path: match[1], Field: match[2]})
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			return secret
+		},
+	)
+
+	return resolved, errors.Join(errs...)
+}
+
+func (r *secretResolver) defaultProvider() string {
+	if len(r.providers) == 1 {
+		for name := range r.providers {
+			return name
+		}
+	}
+
+	return DefaultSecretProvider
+}
+
+func (r *secretResolver) secret(ref SecretRef) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if secret, ok := r.cache[ref]; ok {
+		return secret, nil
+	}
+
+	provider, ok := r.providers[ref.Provider]
+	if !ok {
+		return "", &SecretRefError{Ref: ref, Err: fmt.Errorf("unknown secret provider %s", ref.Provider)}
+	}
+
+	secret, err := provider.Secret(ref)
+	if err != nil {
+		return "", &SecretRefError{Ref: ref, Err: err}
+	}
+
+	r.cache[ref] = secret
+
+	return secret, nil
+}
+
+// resolveSecrets resolves references in values of every leaf key before they are decoded, so failed references are
+// reported with KeyError. Resolved secrets are cached and reused by decodeHook.
+func (e *Embedding) resolveSecrets(configType reflect.Type) error {
+	errs := make([]error, 0)
+
+	for _, f := range leafFields(configType) {
+		value, ok := e.viper.Get(f.key()).(string)
+		if !ok || !hasSecretRef(value) {
+			continue
+		}
+
+		_, err := e.secrets.resolve(value)
+		if err != nil {
+			errs = append(errs, KeyError{Key: f.key(), Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// decodeHook resolves references in string values while they are decoded into config, so every source may hold them.
+func (r *secretResolver) decodeHook() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String {
+			return data, nil
+		}
+
+		value, ok := data.(string)
+		if !ok || !secretURLRef.MatchString(value) && !inlineSecretRef.MatchString(value) {
+			return data, nil
+		}
+
+		return r.resolve(value)
+	}
+}
+
+// WithSecretProvider registers provider resolving references to secrets of the name, e.g. secret://vault/db#password
+// for vault, in values of every source. References are resolved by Init and on every reload, when cached secrets are
+// fetched again, so rotated secrets are picked up.
+func WithSecretProvider(name string, provider SecretProvider) Option {
+	return func(p *Embedding) {
+		if p.secrets == nil {
+			p.secrets = newSecretResolver()
+		}
+
+		p.secrets.providers[name] = provider
+	}
+}
+
+// FileSecretProvider reads secrets from files of the directory, e.g. secret://files/db#password is read from db file.
+// If field is referenced, the file is decoded as YAML or JSON object. Trailing line breaks are trimmed. Paths leading
+// outside of the directory are rejected.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p *FileSecretProvider) Secret(ref SecretRef) (string, error) {
+	filePath := filepath.FromSlash(ref.Path)
+	if !filepath.IsLocal(filePath) {
+		return "", fmt.Errorf("path %s is outside of secrets directory", ref.Path)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.Dir, filePath))
+	if err != nil {
+		return "", err
+	}
+
+	if ref.Field == "" {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	fields := make(map[string]any)
+
+	err = yaml.Unmarshal(data, &fields)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := fields[ref.Field]
+	if !ok {
+		return "", fmt.Errorf("field %s does not exist", ref.Field)
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// MemorySecretProvider keeps secrets in memory by path, e.g. db, or by path and field, e.g. db#password. It is meant
+// for tests and local runs.
+type MemorySecretProvider struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+func NewMemorySecretProvider(secrets map[string]string) *MemorySecretProvider {
+	p := &MemorySecretProvider{secrets: make(map[string]string, len(secrets))}
+	for key, secret := range secrets {
+		p.secrets[key] = secret
+	}
+
+	return p
+}
+
+// Set sets or rotates the secret.
+func (p *MemorySecretProvider) Set(key, secret string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.secrets[key] = secret
+}
+
+func (p *MemorySecretProvider) Secret(ref SecretRef) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key := ref.Path
+	if ref.Field != "" {
+		key += "#" + ref.Field
+	}
+
+	secret, ok := p.secrets[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s does not exist", key)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,340 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var errWatchDisabled = errors.New("config watching is not enabled, use WithWatch option")
+
+// Change describes a config key which value has changed on reload.
+type Change struct {
+	Key string
+	Old any
+	New any
+}
+
+// subscriber receives pointers to the previous and the reloaded configs along with changed keys.
+type subscriber func(old, new reflect.Value, changes []Change)
+
+// reloader keeps the latest config loaded from the watched file. It is shared by copies of Embedding.
+type reloader struct {
+	// mu serializes reloads and guards subscribers.
+	mu         sync.Mutex
+	configType reflect.Type
+	defaults   reflect.Value
+	// state is the config passed to viper by the latest successful load, restored if reload fails.
+	state       configState
+	current     atomic.Value
+	subscribers []subscriber
+	onError     func(error)
+	watcher     *fsnotify.Watcher
+}
+
+func newReloader(configType reflect.Type, onError func(error)) *reloader {
+	if onError == nil {
+		onError = func(err error) {
+			log.Printf("vanya: config reload failed: %s", err)
+		}
+	}
+
+	return &reloader{
+		configType: configType,
+		onError:    onError,
+	}
+}
+
+// copyConfig returns pointer to a deep copy of the config, so decoding into the copy does not modify maps, slices and
+// pointers of the original.
+func copyConfig(configPtr any) reflect.Value {
+	return deepCopy(reflect.ValueOf(configPtr))
+}
+
+// deepCopy copies the value along with values it refers to. Unexported struct fields, e.g. of Embedding, are copied
+// shallowly, as they are not decoded.
+func deepCopy(value reflect.Value) reflect.Value {
+	copied := reflect.New(value.Type()).Elem()
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return copied
+		}
+
+		copied.Set(reflect.New(value.Type().Elem()))
+		copied.Elem().Set(deepCopy(value.Elem()))
+	case reflect.Map:
+		if value.IsNil() {
+			return copied
+		}
+
+		copied.Set(reflect.MakeMapWithSize(value.Type(), value.Len()))
+		for iter := value.MapRange(); iter.Next(); {
+			copied.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+	case reflect.Slice:
+		if value.IsNil() {
+			return copied
+		}
+
+		copied.Set(reflect.MakeSlice(value.Type(), value.Len(), value.Len()))
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(deepCopy(value.Index(i)))
+		}
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(deepCopy(value.Index(i)))
+		}
+	case reflect.Struct:
+		copied.Set(value)
+
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				copied.Field(i).Set(deepCopy(value.Field(i)))
+			}
+		}
+	case reflect.Interface:
+		if !value.IsNil() {
+			copied.Set(deepCopy(value.Elem()))
+		}
+	default:
+		copied.Set(value)
+	}
+
+	return copied
+}
+
+// watch reloads config when one of the files is written or, if the file is a symlink, when its target changes, e.g.
+// on Kubernetes ConfigMap update. Optional files are reloaded when created.
+func (r *reloader) watch(e *Embedding) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	realPaths := make(map[string]string)
+
+	for _, layer := range e.layers {
+		filePath := filepath.Clean(layer.path)
+
+		// directory is watched to pick up atomic saves replacing the file
+		err = watcher.Add(filepath.Dir(filePath))
+		if err != nil {
+			_ = watcher.Close()
+			return err
+		}
+
+		realPaths[filePath], _ = filepath.EvalSymlinks(filePath)
+	}
+
+	r.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				changed := false
+
+				for filePath, realPath := range realPaths {
+					currentPath, _ := filepath.EvalSymlinks(filePath)
+
+					written := filepath.Clean(event.Name) == filePath && event.Has(fsnotify.Write|fsnotify.Create)
+					if written || currentPath != "" && currentPath != realPath {
+						realPaths[filePath] = currentPath
+						changed = true
+					}
+				}
+
+				if changed {
+					r.reload(e)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				r.onError(err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload decodes the files into a fresh copy of the default config and swaps the current one if it is valid. On
+// failure the current config stays in place, and viper and sources are restored to the state it was loaded from.
+func (r *reloader) reload(e *Embedding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, err := e.loadConfig(r.configType)
+	if err != nil {
+		r.onError(err)
+		return
+	}
+
+	err = e.applyConfig(state)
+	if err != nil {
+		r.onError(errors.Join(err, r.restore(e)))
+		return
+	}
+
+	// secrets are fetched again, so rotated ones are picked up
+	e.secrets.reset()
+
+	fresh := deepCopy(r.defaults)
+
+	err = e.decode(fresh.Interface())
+	if err != nil {
+		r.onError(errors.Join(fmt.Errorf("decode reloaded config: %w", err), r.restore(e)))
+		return
+	}
+
+	r.state = state
+
+	old := reflect.ValueOf(r.current.Load())
+
+	changes := r.diff(old, fresh)
+	if len(changes) == 0 {
+		return
+	}
+
+	r.current.Store(fresh.Interface())
+
+	for _, notify := range r.subscribers {
+		notify(old, fresh, changes)
+	}
+}
+
+// restore passes the state of the current config back to viper after failed reload.
+func (r *reloader) restore(e *Embedding) error {
+	err := e.applyConfig(r.state)
+	if err != nil {
+		return fmt.Errorf("restore config: %w", err)
+	}
+
+	return nil
+}
+
+// diff returns changes of leaf keys between two config values.
+func (r *reloader) diff(old, new reflect.Value) []Change {
+	changes := make([]Change, 0)
+
+	for _, f := range leafFields(r.configType) {
+		oldValue := interfaceOf(fieldValue(old, f.index))
+		newValue := interfaceOf(fieldValue(new, f.index))
+
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, Change{Key: f.key(), Old: oldValue, New: newValue})
+		}
+	}
+
+	return changes
+}
+
+func interfaceOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	return v.Interface()
+}
+
+func (r *reloader) subscribe(fn subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Current returns pointer to the latest loaded config. It differs from the config Init was called with only when
+// watching is enabled with WithWatch.
+func (e *Embedding) Current() any {
+	if e.reloader == nil {
+		return e.configValue
+	}
+
+	return e.reloader.current.Load()
+}
+
+// OnChange registers fn called with every changed key after config is reloaded.
+func (e *Embedding) OnChange(fn func(changes []Change)) error {
+	if e.reloader == nil {
+		return errWatchDisabled
+	}
+
+	e.reloader.subscribe(
+		func(_, _ reflect.Value, changes []Change) {
+			fn(changes)
+		},
+	)
+
+	return nil
+}
+
+// Close stops watching config file.
+func (e *Embedding) Close() error {
+	if e.reloader == nil || e.reloader.watcher == nil {
+		return nil
+	}
+
+	return e.reloader.watcher.Close()
+}
+
+// Subscribe registers fn called after reload when value under the key, e.g. logger_config.level, or any of its nested
+// keys changes. T must be the type of the field under the key.
+func Subscribe[T any](e *Embedding, key string, fn func(old, new T)) error {
+	if e.reloader == nil {
+		return errWatchDisabled
+	}
+
+	f, ok := findField(e.reloader.configType, key)
+	if !ok {
+		return fmt.Errorf("unknown config key %s", key)
+	}
+
+	if valueType := reflect.TypeOf((*T)(nil)).Elem(); valueType != f.typ {
+		return fmt.Errorf("config key %s has type %s, not %s", key, f.typ, valueType)
+	}
+
+	prefix := f.key() + keyDelimiter
+
+	e.reloader.subscribe(
+		func(old, new reflect.Value, changes []Change) {
+			for _, change := range changes {
+				if change.Key != f.key() && !strings.HasPrefix(change.Key, prefix) {
+					continue
+				}
+
+				fn(valueOf[T](old, f.index), valueOf[T](new, f.index))
+
+				return
+			}
+		},
+	)
+
+	return nil
+}
+
+// valueOf returns value of the field in config, or zero value if one of the structs on the way is nil pointer.
+func valueOf[T any](config reflect.Value, index []int) T {
+	var value T
+
+	v := fieldValue(config, index)
+	if v.IsValid() {
+		value = v.Interface().(T)
+	}
+
+	return value
+}
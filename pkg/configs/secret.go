@@ -0,0 +1,80 @@
+package configs
+
+import (
+	"reflect"
+)
+
+// secretMask replaces secret values in Echo output.
+const secretMask = "******"
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Secret is a string masked in Echo output and when formatted with fmt. Fields of other types are marked as secret
+// with `secret:"true"` tag.
+type Secret string
+
+// String returns masked value, so secret does not leak to logs. Use Reveal to get the value.
+func (s Secret) String() string {
+	return secretMask
+}
+
+// Reveal returns the value of the secret.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func isSecret(f field) bool {
+	fieldType := f.typ
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	return fieldType == secretType || f.tag.Get("secret") == "true"
+}
+
+// secretKeys returns keys holding secrets regardless of the field type: the ones read from secret files and the ones
+// referring to secrets of providers. It is called while decoding, as viper is not safe to read concurrently with
+// reload.
+func (e *Embedding) secretKeys(configType reflect.Type, sources map[string]Source) map[string]bool {
+	keys := make(map[string]bool)
+
+	for _, f := range leafFields(configType) {
+		key := f.key()
+
+		value, _ := e.viper.Get(key).(string)
+		if sources[key].Kind == SourceSecretFile || hasSecretRef(value) {
+			keys[key] = true
+		}
+	}
+
+	return keys
+}
+
+// redact replaces values of secret fields of the config type and secret keys in m built by configMap. If reveal is
+// set, secrets are replaced with their plain values instead, so Secret is not printed masked by fmt.
+func redact(m map[string]any, configType reflect.Type, secretKeys map[string]bool, reveal bool) {
+	for _, f := range leafFields(configType) {
+		if !isSecret(f) && !secretKeys[f.key()] {
+			continue
+		}
+
+		parent := m
+		for _, key := range f.path[:len(f.path)-1] {
+			parent, _ = parent[key].(map[string]any)
+		}
+
+		name := f.path[len(f.path)-1]
+
+		value, ok := parent[name]
+		if !ok || value == nil {
+			continue
+		}
+
+		switch {
+		case !reveal:
+			parent[name] = secretMask
+		case reflect.TypeOf(value) == secretType:
+			parent[name] = value.(Secret).Reveal()
+		}
+	}
+}
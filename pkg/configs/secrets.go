@@ -0,0 +1,118 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// secretFileSuffix is appended to environment variable name to read the value from the file it points to, e.g.
+// POSTGRES_CONFIG_PASSWORD_FILE=/run/secrets/pg.
+const secretFileSuffix = "_FILE"
+
+// readSecretFiles reads values of keys from files pointed by environment variables with _FILE suffix or placed in the
+// secrets directory. Values are merged on top of config files, so flags and environment variables holding values take
+// precedence over secret files, which in turn take precedence over config files. They are passed to viper as config
+// and never exported to environment.
+func (e *Embedding) readSecretFiles(configType reflect.Type) (map[string]any, map[string]Source, error) {
+	dirFiles, err := e.secretsDirFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]any)
+	sources := make(map[string]Source)
+	errs := make([]error, 0)
+
+	for _, f := range leafFields(configType) {
+		key := f.key()
+
+		if flag := e.flagSet.Lookup(key); flag != nil && flag.Changed {
+			continue
+		}
+
+		envVar := envVarName(e.envPrefix, f.path)
+		fileEnvVar := envVar + secretFileSuffix
+
+		filePath, ok := os.LookupEnv(fileEnvVar)
+		if ok && filePath != "" {
+			if value, ok := os.LookupEnv(envVar); ok && value != "" {
+				errs = append(errs, fmt.Errorf("both %s and %s are set", envVar, fileEnvVar))
+				continue
+			}
+		} else {
+			if value, ok := os.LookupEnv(envVar); ok && value != "" {
+				continue
+			}
+
+			filePath, ok = dirFiles[secretName(key)]
+			if !ok {
+				continue
+			}
+		}
+
+		value, err := readSecretFile(filePath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read secret %s: %w", key, err))
+			continue
+		}
+
+		setNested(values, f.path, value)
+		sources[key] = Source{Kind: SourceSecretFile, Name: filePath}
+	}
+
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return values, sources, nil
+}
+
+// secretsDirFiles returns files of the secrets directory by their normalized names.
+func (e *Embedding) secretsDirFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	if e.secretsDir == "" {
+		return files, nil
+	}
+
+	entries, err := os.ReadDir(e.secretsDir)
+	if err != nil {
+		return nil, fmt.Errorf("read secrets directory: %w", err)
+	}
+
+	prefix := strings.ToLower(e.envPrefix) + "_"
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := secretName(entry.Name())
+		if e.envPrefix != "" {
+			name = strings.TrimPrefix(name, prefix)
+		}
+
+		files[name] = filepath.Join(e.secretsDir, entry.Name())
+	}
+
+	return files, nil
+}
+
+// secretName normalizes key or file name, so postgres_config.password, POSTGRES_CONFIG_PASSWORD and
+// postgres-config-password match each other.
+func secretName(name string) string {
+	return strings.NewReplacer(keyDelimiter, "_", "-", "_").Replace(strings.ToLower(name))
+}
+
+// readSecretFile returns content of the file without trailing line breaks added by editors and tools.
+func readSecretFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,171 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownKeyError reports a key of the config file or an environment variable with the configured prefix matching no
+// config field. Suggestion is the closest valid key, if any.
+type UnknownKeyError struct {
+	Key        string
+	Source     Source
+	Suggestion string
+}
+
+func (e *UnknownKeyError) Error() string {
+	var msg string
+
+	switch {
+	case e.Source.Kind == SourceEnv:
+		msg = fmt.Sprintf("unknown environment variable %s", e.Key)
+	case e.Source.Line > 0:
+		msg = fmt.Sprintf("%s:%d: unknown key %s", e.Source.Name, e.Source.Line, e.Key)
+	default:
+		msg = fmt.Sprintf("%s: unknown key %s", e.Source.Name, e.Key)
+	}
+
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+
+	return msg
+}
+
+func defaultWarningHandler(err error) {
+	log.Printf("vanya: %s", err)
+}
+
+// checkFileKeys returns UnknownKeyError for every key of the config files matching no field of the config.
+func (e *Embedding) checkFileKeys(configType reflect.Type) error {
+	leaves := leafFields(configType)
+
+	keys := make([]string, len(leaves))
+	for i, f := range leaves {
+		keys[i] = f.key()
+	}
+
+	errs := make([]error, 0)
+
+	for key, source := range e.fileSources {
+		if isKnownKey(keys, key) {
+			continue
+		}
+
+		errs = append(errs, &UnknownKeyError{Key: key, Source: source, Suggestion: closest(keys, key)})
+	}
+
+	sort.Slice(
+		errs, func(i, j int) bool {
+			return errs[i].(*UnknownKeyError).Key < errs[j].(*UnknownKeyError).Key
+		},
+	)
+
+	return errors.Join(errs...)
+}
+
+// isKnownKey reports whether the key is a leaf key or is nested into a leaf, e.g. an entry of a map field.
+func isKnownKey(keys []string, key string) bool {
+	for _, known := range keys {
+		if key == known || strings.HasPrefix(key, known+keyDelimiter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkEnv warns about environment variables with the configured prefix matching no config field.
+func (e *Embedding) checkEnv(configType reflect.Type) {
+	if e.envPrefix == "" {
+		return
+	}
+
+	leaves := leafFields(configType)
+
+	names := make([]string, 0, 2*len(leaves))
+	for _, f := range leaves {
+		name := envVarName(e.envPrefix, f.path)
+		names = append(names, name, name+secretFileSuffix)
+	}
+
+	prefix := strings.ToUpper(e.envPrefix) + "_"
+	unknown := make([]string, 0)
+
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, prefix) || isKnownEnv(names, name) {
+			continue
+		}
+
+		unknown = append(unknown, name)
+	}
+
+	sort.Strings(unknown)
+
+	for _, name := range unknown {
+		e.onWarning(
+			&UnknownKeyError{
+				Key:        name,
+				Source:     Source{Kind: SourceEnv, Name: name},
+				Suggestion: closest(names, name),
+			},
+		)
+	}
+}
+
+func isKnownEnv(names []string, name string) bool {
+	for _, known := range names {
+		if name == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closest returns the candidate with the smallest edit distance to s, if the distance is small enough to be a typo.
+func closest(candidates []string, s string) string {
+	best, bestDistance := "", len(s)/3+1
+
+	for _, candidate := range candidates {
+		distance := editDistance(candidate, s)
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	return best
+}
+
+// editDistance returns Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
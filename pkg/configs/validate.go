@@ -0,0 +1,276 @@
+package configs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// KeyError is a validation or secret resolution failure of a single config key. Key is empty for errors returned by
+// Validate method of the config itself.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e KeyError) Error() string {
+	if e.Key == "" {
+		return e.Err.Error()
+	}
+
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by Init when loaded config is invalid. It lists every invalid key.
+type ValidationError struct {
+	Errors []KeyError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		lines[i] = e.Errors[i].Error()
+	}
+
+	return "invalid config:\n" + strings.Join(lines, "\n")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i := range e.Errors {
+		errs[i] = e.Errors[i]
+	}
+
+	return errs
+}
+
+type validator interface {
+	Validate() error
+}
+
+// validate checks fields of the config against rules in `validate` tags and calls Validate methods of the config and
+// its sections. Rules are separated by commas:
+//
+//   - required: value is not zero;
+//   - min=N, max=N: numbers and durations are compared by value, strings, slices and maps by length;
+//   - oneof=a b c: value is one of space separated values;
+//   - url: value is an absolute URL;
+//   - hostport: value is host:port;
+//   - port: value is a port number;
+//   - regexp=EXPR: value matches the expression. It must be the last rule, as EXPR may contain commas.
+//
+// All rules except required pass for nil pointers, so optional keys are validated only when set. Rules of string
+// formats, url, hostport, port and regexp, pass for empty strings as well, while min, max and oneof check zero values.
+func validate(configPtr any) error {
+	errs := make([]KeyError, 0)
+	config := reflect.ValueOf(configPtr)
+
+	for _, f := range allFields(config.Type()) {
+		value := fieldValue(config, f.index)
+
+		if f.nested {
+			err := validateSection(value)
+			if err != nil {
+				errs = append(errs, KeyError{Key: f.key(), Err: err})
+			}
+
+			continue
+		}
+
+		tag, ok := f.tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		err := validateValue(value, tag)
+		if err != nil {
+			errs = append(errs, KeyError{Key: f.key(), Err: err})
+		}
+	}
+
+	if v, ok := configPtr.(validator); ok {
+		err := v.Validate()
+		if err != nil {
+			errs = append(errs, KeyError{Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// validateSection calls Validate method of the nested struct, declared either on value or on pointer receiver.
+func validateSection(value reflect.Value) error {
+	if !value.IsValid() || value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil
+	}
+
+	if value.Kind() != reflect.Ptr && value.CanAddr() {
+		value = value.Addr()
+	}
+
+	if v, ok := value.Interface().(validator); ok {
+		return v.Validate()
+	}
+
+	return nil
+}
+
+// stringFormatRules pass for empty strings, as empty value of optional key is not malformed.
+var stringFormatRules = map[string]bool{"url": true, "hostport": true, "port": true, "regexp": true}
+
+func validateValue(value reflect.Value, tag string) error {
+	for value.IsValid() && value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	isNil := !value.IsValid()
+	isEmpty := !isNil && value.Kind() == reflect.String && value.Len() == 0
+
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if isNil || value.IsZero() {
+				return fmt.Errorf("value is required")
+			}
+
+			continue
+		}
+
+		if isNil || isEmpty && stringFormatRules[name] {
+			continue
+		}
+
+		err := validateRule(value, name, param)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRule(value reflect.Value, name, param string) error {
+	switch name {
+	case "min", "max":
+		return validateBound(value, name, param)
+	case "oneof":
+		s := stringOf(value)
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("value %q is not one of %s", s, strings.Join(strings.Fields(param), ", "))
+	case "url":
+		u, err := url.Parse(stringOf(value))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("value %q is not an absolute URL", stringOf(value))
+		}
+	case "hostport":
+		_, port, err := net.SplitHostPort(stringOf(value))
+		if err != nil || validatePort(port) != nil {
+			return fmt.Errorf("value %q is not host:port", stringOf(value))
+		}
+	case "port":
+		return validatePort(stringOf(value))
+	case "regexp":
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return fmt.Errorf("invalid validate tag: %w", err)
+		}
+
+		if !re.MatchString(stringOf(value)) {
+			return fmt.Errorf("value %q does not match %s", stringOf(value), param)
+		}
+	default:
+		return fmt.Errorf("invalid validate tag: unknown rule %s", name)
+	}
+
+	return nil
+}
+
+func validateBound(value reflect.Value, name, param string) error {
+	var (
+		actual, bound float64
+		err           error
+		what          = "value"
+	)
+
+	switch {
+	case value.Type() == durationType:
+		var d time.Duration
+
+		d, err = time.ParseDuration(param)
+		actual, bound = float64(value.Int()), float64(d)
+	case value.CanInt():
+		actual = float64(value.Int())
+		bound, err = strconv.ParseFloat(param, 64)
+	case value.CanUint():
+		actual = float64(value.Uint())
+		bound, err = strconv.ParseFloat(param, 64)
+	case value.CanFloat():
+		actual = value.Float()
+		bound, err = strconv.ParseFloat(param, 64)
+	case value.Kind() == reflect.String || value.Kind() == reflect.Slice || value.Kind() == reflect.Map:
+		actual, what = float64(value.Len()), "length"
+		bound, err = strconv.ParseFloat(param, 64)
+	default:
+		return fmt.Errorf("invalid validate tag: %s is not applicable to %s", name, value.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid validate tag: %w", err)
+	}
+
+	if name == "min" && actual < bound {
+		return fmt.Errorf("%s must be at least %s", what, param)
+	}
+
+	if name == "max" && actual > bound {
+		return fmt.Errorf("%s must be at most %s", what, param)
+	}
+
+	return nil
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("value %q is not a port number", port)
+	}
+
+	return nil
+}
+
+// stringOf returns string representation of the value used by string rules.
+func stringOf(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return value.String()
+	}
+
+	return fmt.Sprint(value.Interface())
+}